@@ -0,0 +1,303 @@
+package violetear
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// LogFormat format of the access log lines
+type LogFormat int
+
+// Access log formats
+const (
+	// CommonLog Apache Common Log Format
+	CommonLog LogFormat = iota
+	// CombinedLog Apache Combined Log Format, CommonLog plus referer and
+	// user agent
+	CombinedLog
+	// JSONLog one JSON object per line
+	JSONLog
+	// LogfmtLog key=value pairs separated by space
+	LogfmtLog
+)
+
+// Access log fields used by JSONLog, LogfmtLog and slog
+const (
+	FieldTime       = "time"
+	FieldRemoteAddr = "remote_addr"
+	FieldHost       = "host"
+	FieldMethod     = "method"
+	FieldURI        = "uri"
+	FieldProto      = "proto"
+	FieldStatus     = "status"
+	FieldBytesIn    = "bytes_in"
+	FieldBytesOut   = "bytes_out"
+	FieldDuration   = "duration"
+	FieldTTFB       = "ttfb"
+	FieldRequestID  = "request_id"
+	FieldRoute      = "route"
+	FieldRouteName  = "route_name"
+	FieldUserAgent  = "user_agent"
+	FieldReferer    = "referer"
+)
+
+// DefaultLogFields fields logged when AccessLog.Fields is empty
+var DefaultLogFields = []string{
+	FieldTime,
+	FieldRemoteAddr,
+	FieldMethod,
+	FieldURI,
+	FieldProto,
+	FieldStatus,
+	FieldBytesIn,
+	FieldBytesOut,
+	FieldDuration,
+	FieldRequestID,
+	FieldRoute,
+	FieldUserAgent,
+	FieldReferer,
+}
+
+// AccessLog configurable access logger, its Log method can be used as the
+// router Logger, example:
+//  router.LogRequests = true
+//  router.Logger = (&violetear.AccessLog{
+//      Format: violetear.JSONLog,
+//      Filter: violetear.SkipPaths("/health"),
+//  }).Log
+type AccessLog struct {
+	// Format of the lines, CommonLog by default
+	Format LogFormat
+
+	// Output where the lines are written, os.Stderr by default
+	Output io.Writer
+
+	// Slog when set the fields are logged as the attributes of a record
+	// with the message "request", Format and Output are ignored
+	Slog *slog.Logger
+
+	// Level of the slog records
+	Level slog.Level
+
+	// Fields logged by JSONLog, LogfmtLog and Slog in the given order,
+	// DefaultLogFields if empty
+	Fields []string
+
+	// Filter returns false for the requests that must not be logged
+	Filter func(*ResponseWriter, *http.Request) bool
+
+	// Sample logs only 1 of every Sample requests passing the Filter, 0 or 1
+	// logs all of them
+	Sample uint64
+
+	mu sync.Mutex
+	n  atomic.Uint64
+}
+
+// SkipPaths returns an AccessLog.Filter skipping the requests for the given
+// paths, example: health checks
+func SkipPaths(paths ...string) func(*ResponseWriter, *http.Request) bool {
+	return func(w *ResponseWriter, r *http.Request) bool {
+		for _, p := range paths {
+			if r.URL.Path == p {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// Log writes the access log line for the request
+func (l *AccessLog) Log(w *ResponseWriter, r *http.Request) {
+	if l.Filter != nil && !l.Filter(w, r) {
+		return
+	}
+	if l.Sample > 1 && (l.n.Add(1)-1)%l.Sample != 0 {
+		return
+	}
+
+	fields := l.Fields
+	if len(fields) == 0 {
+		fields = DefaultLogFields
+	}
+
+	if l.Slog != nil {
+		attrs := make([]slog.Attr, 0, len(fields))
+		for _, f := range fields {
+			if v, ok := logField(f, w, r); ok {
+				attrs = append(attrs, slog.Any(f, v))
+			}
+		}
+		l.Slog.LogAttrs(r.Context(), l.Level, "request", attrs...)
+		return
+	}
+
+	var b bytes.Buffer
+	switch l.Format {
+	case JSONLog:
+		b.WriteByte('{')
+		for _, f := range fields {
+			v, ok := logField(f, w, r)
+			if !ok {
+				continue
+			}
+			if b.Len() > 1 {
+				b.WriteByte(',')
+			}
+			b.WriteString(strconv.Quote(f))
+			b.WriteByte(':')
+			if d, ok := v.(time.Duration); ok {
+				v = d.Seconds()
+			}
+			value, err := json.Marshal(v)
+			if err != nil {
+				value = []byte(`""`)
+			}
+			b.Write(value)
+		}
+		b.WriteByte('}')
+	case LogfmtLog:
+		for _, f := range fields {
+			v, ok := logField(f, w, r)
+			if !ok {
+				continue
+			}
+			if b.Len() > 0 {
+				b.WriteByte(' ')
+			}
+			b.WriteString(f)
+			b.WriteByte('=')
+			b.WriteString(logfmtValue(v))
+		}
+	default:
+		// host ident authuser [date] "request" status bytes
+		b.WriteString(dash(remoteHost(r.RemoteAddr)))
+		b.WriteString(" - ")
+		user := "-"
+		if u, _, ok := r.BasicAuth(); ok && u != "" {
+			user = u
+		} else if r.URL.User != nil && r.URL.User.Username() != "" {
+			user = r.URL.User.Username()
+		}
+		b.WriteString(user)
+		b.WriteString(" [")
+		b.WriteString(w.start.Format("02/Jan/2006:15:04:05 -0700"))
+		b.WriteString("] ")
+		b.WriteString(strconv.Quote(r.Method + " " + r.URL.RequestURI() + " " + r.Proto))
+		b.WriteByte(' ')
+		b.WriteString(strconv.Itoa(w.Status()))
+		b.WriteByte(' ')
+		b.WriteString(dash(strconv.Itoa(w.Size())))
+		if l.Format == CombinedLog {
+			b.WriteByte(' ')
+			b.WriteString(strconv.Quote(dash(r.Referer())))
+			b.WriteByte(' ')
+			b.WriteString(strconv.Quote(dash(r.UserAgent())))
+		}
+	}
+	b.WriteByte('\n')
+
+	out := l.Output
+	if out == nil {
+		out = os.Stderr
+	}
+	l.mu.Lock()
+	out.Write(b.Bytes())
+	l.mu.Unlock()
+}
+
+// logField returns the value of the field f, false if the field is unknown
+func logField(f string, w *ResponseWriter, r *http.Request) (interface{}, bool) {
+	switch f {
+	case FieldTime:
+		return w.start.Format(time.RFC3339Nano), true
+	case FieldRemoteAddr:
+		return r.RemoteAddr, true
+	case FieldHost:
+		return r.Host, true
+	case FieldMethod:
+		return r.Method, true
+	case FieldURI:
+		return r.URL.RequestURI(), true
+	case FieldProto:
+		return r.Proto, true
+	case FieldStatus:
+		return w.Status(), true
+	case FieldBytesIn:
+		// the bytes read when the length is unknown, example: chunked
+		if r.ContentLength > 0 {
+			return r.ContentLength, true
+		}
+		return w.BytesRead(), true
+	case FieldBytesOut:
+		return w.Size(), true
+	case FieldDuration:
+		return w.Duration(), true
+	case FieldTTFB:
+		return w.TTFB(), true
+	case FieldRequestID:
+		return w.RequestID(), true
+	case FieldRoute:
+		if info := w.Route(); info != nil {
+			return info.Pattern, true
+		}
+		return "", true
+	case FieldRouteName:
+		if info := w.Route(); info != nil {
+			return info.Name, true
+		}
+		return "", true
+	case FieldUserAgent:
+		return r.UserAgent(), true
+	case FieldReferer:
+		return r.Referer(), true
+	}
+	return nil, false
+}
+
+// logfmtValue returns the value quoted if needed
+func logfmtValue(v interface{}) string {
+	var s string
+	switch v := v.(type) {
+	case string:
+		s = v
+	case int:
+		return strconv.Itoa(v)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case time.Duration:
+		return v.String()
+	}
+	if s == "" || strings.ContainsAny(s, " =\"\\") || strings.IndexFunc(s, func(r rune) bool {
+		return r < ' '
+	}) != -1 {
+		return strconv.Quote(s)
+	}
+	return s
+}
+
+// remoteHost returns the host of the remote address
+func remoteHost(addr string) string {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return addr
+}
+
+// dash returns "-" for empty or zero values
+func dash(s string) string {
+	if s == "" || s == "0" {
+		return "-"
+	}
+	return s
+}
@@ -0,0 +1,108 @@
+package violetear
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// serveLogged serves a request using the access log, returns the output
+func serveLogged(l *AccessLog, method, path string, body string) string {
+	var out bytes.Buffer
+	l.Output = &out
+	router := New()
+	router.Verbose = false
+	router.LogRequests = true
+	router.RequestID = "Request-ID"
+	router.Logger = l.Log
+	router.AddRegex(":id", `^\d+$`)
+	router.HandleFunc("/item/:id", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("item"))
+	}).Name("item")
+	router.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {})
+
+	req, _ := http.NewRequest(method, path, strings.NewReader(body))
+	req.RemoteAddr = "10.0.0.1:1234"
+	req.Header.Set("Request-ID", "abc")
+	req.Header.Set("User-Agent", "test agent")
+	req.Header.Set("Referer", "http://example.com/")
+	router.ServeHTTP(httptest.NewRecorder(), req)
+	return out.String()
+}
+
+func TestAccessLogCommon(t *testing.T) {
+	line := serveLogged(&AccessLog{}, "GET", "/item/1?q=1", "")
+	expect(t, strings.HasPrefix(line, "10.0.0.1 - - ["), true)
+	expect(t, strings.HasSuffix(line, `] "GET /item/1?q=1 HTTP/1.1" 200 4`+"\n"), true)
+
+	line = serveLogged(&AccessLog{Format: CombinedLog}, "GET", "/none", "")
+	expect(t, strings.HasSuffix(line, `] "GET /none HTTP/1.1" 404 19 "http://example.com/" "test agent"`+"\n"), true)
+}
+
+func TestAccessLogJSON(t *testing.T) {
+	line := serveLogged(&AccessLog{
+		Format: JSONLog,
+		Fields: []string{FieldMethod, FieldStatus, FieldBytesIn, FieldBytesOut, FieldRoute, FieldRouteName, FieldRequestID, FieldDuration, "unknown"},
+	}, "POST", "/item/1", "hello")
+
+	var fields map[string]interface{}
+	expect(t, json.Unmarshal([]byte(line), &fields), nil)
+	expect(t, len(fields), 8)
+	expect(t, fields["method"], "POST")
+	expect(t, fields["status"], float64(200))
+	expect(t, fields["bytes_in"], float64(5))
+	expect(t, fields["bytes_out"], float64(4))
+	expect(t, fields["route"], "/item/:id")
+	expect(t, fields["route_name"], "item")
+	expect(t, fields["request_id"], "abc")
+	_, ok := fields["duration"].(float64)
+	expect(t, ok, true)
+	expect(t, strings.HasPrefix(line, `{"method":"POST","status":200,`), true)
+}
+
+func TestAccessLogLogfmt(t *testing.T) {
+	line := serveLogged(&AccessLog{
+		Format: LogfmtLog,
+		Fields: []string{FieldMethod, FieldURI, FieldStatus, FieldRoute, FieldUserAgent, FieldRouteName},
+	}, "GET", "/item/2", "")
+	expect(t, line, `method=GET uri=/item/2 status=200 route=/item/:id user_agent="test agent" route_name=item`+"\n")
+}
+
+func TestAccessLogSlog(t *testing.T) {
+	var out bytes.Buffer
+	l := &AccessLog{
+		Slog:   slog.New(slog.NewTextHandler(&out, &slog.HandlerOptions{ReplaceAttr: noTime})),
+		Level:  slog.LevelWarn,
+		Fields: []string{FieldMethod, FieldStatus, FieldRoute},
+	}
+	line := serveLogged(l, "GET", "/item/3", "")
+	expect(t, line, "")
+	expect(t, out.String(), "level=WARN msg=request method=GET status=200 route=/item/:id\n")
+}
+
+func TestAccessLogFilterSample(t *testing.T) {
+	l := &AccessLog{Filter: SkipPaths("/health")}
+	expect(t, serveLogged(l, "GET", "/health", ""), "")
+	expect(t, serveLogged(l, "GET", "/item/1", "") != "", true)
+
+	l = &AccessLog{Sample: 3}
+	var logged int
+	for i := 0; i < 9; i++ {
+		if serveLogged(l, "GET", "/item/1", "") != "" {
+			logged++
+		}
+	}
+	expect(t, logged, 3)
+}
+
+// noTime removes the time from the slog records
+func noTime(groups []string, a slog.Attr) slog.Attr {
+	if a.Key == slog.TimeKey && len(groups) == 0 {
+		return slog.Attr{}
+	}
+	return a
+}
@@ -0,0 +1,159 @@
+package violetear
+
+import (
+	"compress/gzip"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"sync/atomic"
+)
+
+// MaxBodySize limits the request body of the route to n bytes using
+// http.MaxBytesReader, example:
+//  router.HandleFunc("/upload", upload, "POST").MaxBodySize(10 << 20)
+// Requests with a bigger Content-Length are answered by the
+// RequestEntityTooLargeHandler without calling the handler, when the body
+// length is unknown reading past the limit returns *http.MaxBytesError and
+// the RequestEntityTooLargeHandler is called if the handler returns without
+// writing the response. Like Use, the limits and Decompress are applied in
+// the order they are added.
+func (r *Route) MaxBodySize(n int64) *Route {
+	return r.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			if req.Body == nil || req.Body == http.NoBody {
+				next.ServeHTTP(w, req)
+				return
+			}
+			if req.ContentLength > n {
+				r.router.requestEntityTooLarge().ServeHTTP(w, req)
+				return
+			}
+			r2 := *req
+			r2.Body = http.MaxBytesReader(w, req.Body, n)
+			r.router.serveLimited(w, &r2, next)
+		})
+	})
+}
+
+// Decompress decompresses the request bodies with Content-Encoding gzip up
+// to maxSize bytes, example:
+//  router.HandleFunc("/ingest", ingest, "POST").MaxBodySize(1 << 20).Decompress(10 << 20)
+// The handler receives the decompressed body without the Content-Encoding
+// and Content-Length headers, reading more than maxSize bytes returns
+// *http.MaxBytesError and the RequestEntityTooLargeHandler is called if the
+// handler returns without writing the response, it stops the zip bombs.
+// Invalid gzip data is answered with 400 and other encodings with the
+// UnsupportedMediaTypeHandler.
+func (r *Route) Decompress(maxSize int64) *Route {
+	return r.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			switch strings.ToLower(strings.TrimSpace(req.Header.Get("Content-Encoding"))) {
+			case "", "identity":
+				next.ServeHTTP(w, req)
+				return
+			case "gzip", "x-gzip":
+			default:
+				if r.router.UnsupportedMediaTypeHandler != nil {
+					r.router.UnsupportedMediaTypeHandler.ServeHTTP(w, req)
+					return
+				}
+				r.router.UnsupportedMediaType().ServeHTTP(w, req)
+				return
+			}
+			body := req.Body
+			if body == nil {
+				body = http.NoBody
+			}
+			gz, err := gzip.NewReader(body)
+			if err != nil {
+				var mbe *http.MaxBytesError
+				if errors.As(err, &mbe) {
+					r.router.requestEntityTooLarge().ServeHTTP(w, req)
+					return
+				}
+				http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+				return
+			}
+			r2 := *req
+			r2.Header = req.Header.Clone()
+			r2.Header.Del("Content-Encoding")
+			r2.Header.Del("Content-Length")
+			r2.ContentLength = -1
+			r2.Body = struct {
+				io.Reader
+				io.Closer
+			}{&maxReader{r: gz, n: maxSize, limit: maxSize}, body}
+			r.router.serveLimited(w, &r2, next)
+		})
+	})
+}
+
+// requestEntityTooLarge returns the handler for 413
+func (r *Router) requestEntityTooLarge() http.Handler {
+	if r.RequestEntityTooLargeHandler != nil {
+		return r.RequestEntityTooLargeHandler
+	}
+	return r.RequestEntityTooLarge()
+}
+
+// serveLimited serves the request with the limited body, if the limit was
+// exceeded and the handler didn't write the response the
+// RequestEntityTooLargeHandler is called
+func (r *Router) serveLimited(w http.ResponseWriter, req *http.Request, next http.Handler) {
+	body := &limitBody{ReadCloser: req.Body}
+	req.Body = body
+	// the writer is wrapped to know if the response was written
+	ww := GetResponseWriter(w)
+	if ww == nil {
+		w, ww = WrapResponseWriter(w, "")
+	}
+	next.ServeHTTP(w, req)
+	if !body.exceeded.Load() {
+		return
+	}
+	if !ww.WroteHeader() {
+		r.requestEntityTooLarge().ServeHTTP(w, req)
+	}
+}
+
+// limitBody records whether reading the body exceeded the limit
+type limitBody struct {
+	io.ReadCloser
+	exceeded atomic.Bool
+}
+
+// Read reads from the request body
+func (b *limitBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	var mbe *http.MaxBytesError
+	if errors.As(err, &mbe) {
+		b.exceeded.Store(true)
+	}
+	return n, err
+}
+
+// maxReader returns *http.MaxBytesError after reading limit bytes
+type maxReader struct {
+	r        io.Reader
+	n, limit int64
+}
+
+// Read reads up to the remaining bytes
+func (m *maxReader) Read(p []byte) (int, error) {
+	if m.n < 0 {
+		return 0, &http.MaxBytesError{Limit: m.limit}
+	}
+	// read one more byte to know if the limit is exceeded
+	if int64(len(p)) > m.n+1 {
+		p = p[:m.n+1]
+	}
+	n, err := m.r.Read(p)
+	if int64(n) <= m.n {
+		m.n -= int64(n)
+		return n, err
+	}
+	n = int(m.n)
+	m.n = -1
+	return n, &http.MaxBytesError{Limit: m.limit}
+}
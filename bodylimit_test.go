@@ -0,0 +1,134 @@
+package violetear
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// gzipped returns s compressed with gzip
+func gzipped(s string) []byte {
+	var b bytes.Buffer
+	gw := gzip.NewWriter(&b)
+	gw.Write([]byte(s))
+	gw.Close()
+	return b.Bytes()
+}
+
+// chunked hides the length of the reader
+type chunked struct{ io.Reader }
+
+func TestMaxBodySize(t *testing.T) {
+	router := New()
+	router.Verbose = false
+	echo := func(w http.ResponseWriter, r *http.Request) {
+		b, err := io.ReadAll(r.Body)
+		var mbe *http.MaxBytesError
+		if errors.As(err, &mbe) {
+			return
+		}
+		w.Write(b)
+	}
+	router.HandleFunc("/upload", echo, "POST").MaxBodySize(5)
+	router.HandleFunc("/handled", func(w http.ResponseWriter, r *http.Request) {
+		if _, err := io.ReadAll(r.Body); err != nil {
+			http.Error(w, "too big", http.StatusBadRequest)
+		}
+	}, "POST").MaxBodySize(5)
+
+	tt := []struct {
+		path string
+		body io.Reader
+		code int
+		out  string
+	}{
+		{"/upload", strings.NewReader("12345"), 200, "12345"},
+		{"/upload", strings.NewReader("123456"), 413, "Request Entity Too Large\n"},
+		{"/upload", chunked{strings.NewReader("12345")}, 200, "12345"},
+		{"/upload", chunked{strings.NewReader("123456")}, 413, "Request Entity Too Large\n"},
+		{"/upload", http.NoBody, 200, ""},
+		{"/handled", chunked{strings.NewReader("123456")}, 400, "too big\n"},
+	}
+	for _, tc := range tt {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", tc.path, tc.body)
+		router.ServeHTTP(w, req)
+		expect(t, w.Code, tc.code)
+		expect(t, w.Body.String(), tc.out)
+	}
+
+	router.RequestEntityTooLargeHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusRequestEntityTooLarge)
+		w.Write([]byte("custom"))
+	})
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/upload", strings.NewReader("123456"))
+	router.ServeHTTP(w, req)
+	expect(t, w.Code, http.StatusRequestEntityTooLarge)
+	expect(t, w.Body.String(), "custom")
+}
+
+func TestDecompress(t *testing.T) {
+	var (
+		encoding string
+		length   int64
+	)
+	router := New()
+	router.Verbose = false
+	router.HandleFunc("/ingest", func(w http.ResponseWriter, r *http.Request) {
+		encoding, length = r.Header.Get("Content-Encoding"), r.ContentLength
+		b, err := io.ReadAll(r.Body)
+		if err != nil {
+			return
+		}
+		w.Write(b)
+	}, "POST").MaxBodySize(1000).Decompress(10)
+
+	tt := []struct {
+		encoding string
+		body     []byte
+		code     int
+		out      string
+	}{
+		{"", []byte("plain"), 200, "plain"},
+		{"identity", []byte("plain"), 200, "plain"},
+		{"gzip", gzipped("0123456789"), 200, "0123456789"},
+		{"gzip", gzipped("0123456789a"), 413, "Request Entity Too Large\n"},
+		{"gzip", gzipped(strings.Repeat("a", 10000)), 413, "Request Entity Too Large\n"},
+		{"gzip", []byte("not gzip"), 400, "Bad Request\n"},
+		{"br", []byte("brotli"), 415, "Unsupported Media Type\n"},
+	}
+	for _, tc := range tt {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/ingest", bytes.NewReader(tc.body))
+		if tc.encoding != "" {
+			req.Header.Set("Content-Encoding", tc.encoding)
+		}
+		router.ServeHTTP(w, req)
+		expect(t, w.Code, tc.code)
+		expect(t, w.Body.String(), tc.out)
+		if tc.code == http.StatusOK && tc.encoding == "gzip" {
+			expect(t, encoding, "")
+			expect(t, length, int64(-1))
+		}
+	}
+}
+
+func TestMaxReader(t *testing.T) {
+	m := &maxReader{r: strings.NewReader("0123456789"), n: 4, limit: 4}
+	b, err := io.ReadAll(m)
+	expect(t, string(b), "0123")
+	var mbe *http.MaxBytesError
+	expect(t, errors.As(err, &mbe), true)
+	expect(t, mbe.Limit, int64(4))
+
+	m = &maxReader{r: strings.NewReader("0123"), n: 4, limit: 4}
+	b, err = io.ReadAll(m)
+	expect(t, string(b), "0123")
+	expect(t, err, nil)
+}
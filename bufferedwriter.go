@@ -0,0 +1,135 @@
+package violetear
+
+import (
+	"bytes"
+	"net/http"
+	"strconv"
+)
+
+// BufferedWriter a ResponseWriter for middleware that keeps the response
+// (status and body) until Send is called so it can be inspected or
+// transformed, when the body exceeds the limit or the handler flushes, the
+// response is streamed and can no longer be modified, example:
+//  bw := violetear.NewBufferedWriter(w, 1<<20)
+//  next.ServeHTTP(bw, r)
+//  if bw.Buffered() && bw.Status() >= 500 {
+//      bw.Header().Set("Content-Type", "text/html; charset=utf-8")
+//      bw.SetBody(errorPage)
+//  }
+//  bw.Send()
+// Status, Size, WroteHeader and TTFB report what the handler wrote.
+type BufferedWriter struct {
+	*ResponseWriter
+	limit     int
+	buf       bytes.Buffer
+	streaming bool
+}
+
+// NewBufferedWriter returns a BufferedWriter buffering up to limit bytes of
+// the body, no limit if limit <= 0
+func NewBufferedWriter(w http.ResponseWriter, limit int) *BufferedWriter {
+	return &BufferedWriter{
+		ResponseWriter: NewResponseWriter(w, ""),
+		limit:          limit,
+	}
+}
+
+// WriteHeader keeps the status code, informational headers are written
+func (b *BufferedWriter) WriteHeader(statusCode int) {
+	w := b.ResponseWriter
+	if w.wroteHeader {
+		return
+	}
+	if statusCode >= 100 && statusCode < 200 && statusCode != http.StatusSwitchingProtocols {
+		w.ResponseWriter.WriteHeader(statusCode)
+		return
+	}
+	w.status = statusCode
+	w.writeHeader()
+}
+
+// Write buffers the data, if the limit is exceeded the response is streamed
+func (b *BufferedWriter) Write(data []byte) (int, error) {
+	w := b.ResponseWriter
+	w.writeHeader()
+	w.size += len(data)
+	if !b.streaming && b.limit > 0 && b.buf.Len()+len(data) > b.limit {
+		if err := b.stream(); err != nil {
+			return 0, err
+		}
+	}
+	if b.streaming {
+		return w.ResponseWriter.Write(data)
+	}
+	return b.buf.Write(data)
+}
+
+// Flush streams the response and flushes it if the wrapped writer supports
+// it, implements http.Flusher
+func (b *BufferedWriter) Flush() {
+	b.ResponseWriter.writeHeader()
+	if err := b.stream(); err != nil {
+		return
+	}
+	if f, ok := b.ResponseWriter.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Buffered reports whether the response is still buffered and can be
+// modified
+func (b *BufferedWriter) Buffered() bool {
+	return !b.streaming
+}
+
+// Body returns the buffered body
+func (b *BufferedWriter) Body() []byte {
+	return b.buf.Bytes()
+}
+
+// SetBody replaces the buffered body, no effect once streaming
+func (b *BufferedWriter) SetBody(body []byte) {
+	if b.streaming {
+		return
+	}
+	b.buf.Reset()
+	b.buf.Write(body)
+}
+
+// SetStatus replaces the status code, no effect once streaming
+func (b *BufferedWriter) SetStatus(statusCode int) {
+	if b.streaming {
+		return
+	}
+	b.ResponseWriter.status = statusCode
+	b.ResponseWriter.writeHeader()
+}
+
+// Send writes the buffered response setting the Content-Length, it must be
+// called once the handler returns, no effect once streaming
+func (b *BufferedWriter) Send() error {
+	if b.streaming {
+		return nil
+	}
+	if b.buf.Len() > 0 && b.Header().Get("Transfer-Encoding") == "" {
+		b.Header().Set("Content-Length", strconv.Itoa(b.buf.Len()))
+	}
+	return b.stream()
+}
+
+// stream writes the status and the buffered body, the next writes go
+// directly to the wrapped writer
+func (b *BufferedWriter) stream() error {
+	if b.streaming {
+		return nil
+	}
+	b.streaming = true
+	w := b.ResponseWriter.ResponseWriter
+	w.WriteHeader(b.ResponseWriter.status)
+	if b.buf.Len() == 0 {
+		return nil
+	}
+	_, err := w.Write(b.buf.Bytes())
+	b.buf.Reset()
+	return err
+}
@@ -0,0 +1,102 @@
+package violetear
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestBufferedWriter(t *testing.T) {
+	tt := []struct {
+		name      string
+		limit     int
+		handler   func(w http.ResponseWriter)
+		buffered  bool
+		status    int
+		body      string
+		length    string
+		substitue bool
+	}{
+		{"buffered", 10, func(w http.ResponseWriter) {
+			w.Write([]byte("hello"))
+		}, true, 200, "HELLO", "5", false},
+		{"no limit", 0, func(w http.ResponseWriter) {
+			w.Write(bytes.Repeat([]byte("a"), 100))
+		}, true, 200, strings.Repeat("A", 100), "100", false},
+		{"exceeds limit", 4, func(w http.ResponseWriter) {
+			w.Write([]byte("abc"))
+			w.Write([]byte("def"))
+			w.Write([]byte("ghi"))
+		}, false, 200, "abcdefghi", "", false},
+		{"flush", 10, func(w http.ResponseWriter) {
+			w.Write([]byte("abc"))
+			w.(http.Flusher).Flush()
+			w.Write([]byte("def"))
+		}, false, 200, "abcdef", "", false},
+		{"error page", 10, func(w http.ResponseWriter) {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.WriteHeader(http.StatusOK)
+			w.Write([]byte("trace"))
+		}, true, 500, "error page", "10", true},
+		{"empty", 10, func(w http.ResponseWriter) {
+			w.WriteHeader(http.StatusNoContent)
+		}, true, 204, "", "", false},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			bw := NewBufferedWriter(rec, tc.limit)
+			tc.handler(bw)
+			expect(t, bw.Buffered(), tc.buffered)
+			expect(t, bw.Status(), tc.status)
+			if bw.Buffered() {
+				expect(t, rec.Body.Len(), 0)
+				if tc.substitue {
+					bw.SetBody([]byte("error page"))
+				} else {
+					bw.SetBody(bytes.ToUpper(bw.Body()))
+				}
+			}
+			expect(t, bw.Send(), nil)
+			expect(t, rec.Code, tc.status)
+			expect(t, rec.Body.String(), tc.body)
+			expect(t, rec.Header().Get("Content-Length"), tc.length)
+		})
+	}
+}
+
+func TestBufferedWriterMiddleware(t *testing.T) {
+	router := New()
+	router.Verbose = false
+	router.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			bw := NewBufferedWriter(w, 1<<10)
+			next.ServeHTTP(bw, r)
+			if bw.Buffered() && bw.Status() == http.StatusNotFound {
+				bw.Header().Set("Content-Type", "text/html; charset=utf-8")
+				bw.SetStatus(http.StatusGone)
+				bw.SetBody([]byte("<h1>gone</h1>"))
+			}
+			bw.Send()
+		})
+	})
+	router.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("root"))
+	})
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/missing", nil)
+	router.ServeHTTP(w, req)
+	expect(t, w.Code, http.StatusGone)
+	expect(t, w.Body.String(), "<h1>gone</h1>")
+	expect(t, w.Header().Get("Content-Type"), "text/html; charset=utf-8")
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/", nil)
+	router.ServeHTTP(w, req)
+	expect(t, w.Code, http.StatusOK)
+	expect(t, w.Body.String(), "root")
+	expect(t, w.Header().Get("Content-Length"), "4")
+}
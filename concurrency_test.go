@@ -0,0 +1,113 @@
+// Test
+//
+// go test -race -run=Concurrent
+
+package violetear
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+func TestConcurrentRegistration(t *testing.T) {
+	router := New()
+	router.Verbose = false
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			name := fmt.Sprintf(":r%d", i)
+			if err := router.AddRegex(name, `^\d+$`); err != nil {
+				t.Error(err)
+			}
+			for j := 0; j < 25; j++ {
+				router.HandleFunc(fmt.Sprintf("/%d/%d/%s", i, j, name), func(w http.ResponseWriter, r *http.Request) {}, "GET").
+					Name(fmt.Sprintf("route-%d-%d", i, j)).
+					Headers("X-Test", "")
+			}
+		}(i)
+	}
+	wg.Wait()
+	expect(t, router.GetError(), nil)
+
+	for i := 0; i < 8; i++ {
+		for j := 0; j < 25; j++ {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", fmt.Sprintf("/%d/%d/1", i, j), nil)
+			req.Header.Set("X-Test", "1")
+			router.ServeHTTP(w, req)
+			expect(t, w.Code, 200)
+		}
+	}
+}
+
+func TestConcurrentRegistrationAndServing(t *testing.T) {
+	router := New()
+	router.Verbose = false
+	router.AddRegex(":id", `^\d+$`)
+	router.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {})
+
+	done := make(chan struct{})
+	var serving sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		serving.Add(1)
+		go func() {
+			defer serving.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				w := httptest.NewRecorder()
+				req, _ := http.NewRequest("GET", "/", nil)
+				req.Host = "api.example.com"
+				router.ServeHTTP(w, req)
+				if w.Code != 200 && w.Code != 404 {
+					t.Errorf("unexpected status %d", w.Code)
+				}
+				w = httptest.NewRecorder()
+				req, _ = http.NewRequest("GET", "/item/1", nil)
+				router.ServeHTTP(w, req)
+			}
+		}()
+	}
+
+	var registering sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		registering.Add(1)
+		go func(i int) {
+			defer registering.Done()
+			for j := 0; j < 50; j++ {
+				router.HandleFunc(fmt.Sprintf("/item/:id/%d/%d", i, j), func(w http.ResponseWriter, r *http.Request) {})
+				router.AddRegex(fmt.Sprintf(":w%d", i), `^\w+$`)
+				router.Host("api.example.com").HandleFunc(fmt.Sprintf("/%d/%d", i, j), func(w http.ResponseWriter, r *http.Request) {})
+				router.GetError()
+			}
+		}(i)
+	}
+	registering.Wait()
+	close(done)
+	serving.Wait()
+	expect(t, router.GetError(), nil)
+}
+
+func TestConcurrentErrors(t *testing.T) {
+	router := New()
+	router.Verbose = false
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			router.HandleFunc(fmt.Sprintf("/%d/:missing", i), func(w http.ResponseWriter, r *http.Request) {})
+		}(i)
+	}
+	wg.Wait()
+	expect(t, router.GetError() != nil, true)
+}
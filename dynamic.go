@@ -19,7 +19,10 @@ func (d dynamicSet) Set(name, regex string) error {
 		regex = fmt.Sprintf("^%s$", regex)
 	}
 
-	r := regexp.MustCompile(regex)
+	r, err := regexp.Compile(regex)
+	if err != nil {
+		return err
+	}
 	d[name] = r
 
 	return nil
@@ -22,6 +22,15 @@ func TestSetOkName(t *testing.T) {
 	}
 }
 
+func TestSetBadRegex(t *testing.T) {
+	s := make(dynamicSet)
+	err := s.Set(":test", "[")
+	if err == nil {
+		t.Error("Set regex: [")
+	}
+	expect(t, len(s), 0)
+}
+
 func TestRegex(t *testing.T) {
 	s := make(dynamicSet)
 	s.Set(":ip", `^(?:[0-9]{1,3}\.){3}[0-9]{1,3}$`)
@@ -0,0 +1,97 @@
+package violetear
+
+import (
+	"fmt"
+	"reflect"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+// pkgPath import path of the package, used to find the caller adding a route
+var pkgPath = strings.TrimSuffix(runtime.FuncForPC(reflect.ValueOf(New).Pointer()).Name(), ".New")
+
+// RouteError error resulted from building a route
+type RouteError struct {
+	// Path of the route or host pattern
+	Path string
+
+	// File and Line where the route was added
+	File string
+	Line int
+
+	Err error
+}
+
+// Error returns the error prefixed with the file:line where the route was
+// added
+func (e *RouteError) Error() string {
+	return fmt.Sprintf("%s:%d: %s: %s", e.File, e.Line, e.Path, e.Err)
+}
+
+// Unwrap returns the underlying error
+func (e *RouteError) Unwrap() error {
+	return e.Err
+}
+
+// RouteErrors all the errors resulted from building the routes
+type RouteErrors []*RouteError
+
+// Error returns one error per line
+func (e RouteErrors) Error() string {
+	s := make([]string, len(e))
+	for i, err := range e {
+		s[i] = err.Error()
+	}
+	return strings.Join(s, "\n")
+}
+
+// Unwrap returns the errors, used by errors.Is and errors.As
+func (e RouteErrors) Unwrap() []error {
+	errs := make([]error, len(e))
+	for i, err := range e {
+		errs[i] = err
+	}
+	return errs
+}
+
+// errorList keeps the errors resulted from building the routes
+type errorList struct {
+	sync.Mutex
+	errs RouteErrors
+}
+
+// add appends an error to the list
+func (l *errorList) add(err *RouteError) {
+	l.Lock()
+	l.errs = append(l.errs, err)
+	l.Unlock()
+}
+
+// get returns a copy of the errors
+func (l *errorList) get() RouteErrors {
+	l.Lock()
+	defer l.Unlock()
+	return append(RouteErrors(nil), l.errs...)
+}
+
+// newRouteError returns a RouteError using the file and line of the first
+// caller outside the Router, Route and Group methods
+func newRouteError(path string, err error) *RouteError {
+	e := &RouteError{Path: path, Err: err}
+	pc := make([]uintptr, 16)
+	frames := runtime.CallersFrames(pc[:runtime.Callers(2, pc)])
+	for {
+		frame, more := frames.Next()
+		if !strings.HasPrefix(frame.Function, pkgPath+".(*Router).") &&
+			!strings.HasPrefix(frame.Function, pkgPath+".(*Route).") &&
+			!strings.HasPrefix(frame.Function, pkgPath+".(*Group).") {
+			e.File, e.Line = frame.File, frame.Line
+			break
+		}
+		if !more {
+			break
+		}
+	}
+	return e
+}
@@ -0,0 +1,85 @@
+package violetear
+
+import (
+	"errors"
+	"net/http"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestRouteErrors(t *testing.T) {
+	router := New()
+	router.Verbose = false
+	handler := func(w http.ResponseWriter, r *http.Request) {}
+
+	_, file, line, _ := runtime.Caller(0)
+	router.HandleFunc("/:none", handler).Name("x")
+	router.HandleFunc("/*/test", handler, "GET").Name("y").Headers("X-Test", "")
+	router.HandleFunc("/ok", handler).Headers("X-Odd")
+	router.Host(":tenant.example.com").HandleFunc("/:other", handler)
+	router.HandleFunc("/ok", handler)
+
+	err := router.GetError()
+	expect(t, err != nil, true)
+
+	var errs RouteErrors
+	expect(t, errors.As(err, &errs), true)
+	expect(t, len(errs), 5)
+
+	tt := []struct {
+		path string
+		line int
+	}{
+		{"/:none", line + 1},
+		{"/*/test", line + 2},
+		{"/ok", line + 3},
+		{":tenant.example.com", line + 4},
+		{"/:other", line + 4},
+	}
+	for i, tc := range tt {
+		expect(t, errs[i].Path, tc.path)
+		expect(t, filepath.Base(errs[i].File), filepath.Base(file))
+		expect(t, errs[i].Line, tc.line)
+	}
+	expect(t, len(strings.Split(err.Error(), "\n")), 5)
+
+	var routeErr *RouteError
+	expect(t, errors.As(err, &routeErr), true)
+	expect(t, routeErr.Path, "/:none")
+}
+
+func TestRouteErrorsGroup(t *testing.T) {
+	router := New()
+	router.Verbose = false
+	api := router.Group("/api")
+
+	_, file, line, _ := runtime.Caller(0)
+	api.HandleFunc("/:missing", func(w http.ResponseWriter, r *http.Request) {})
+	api.Group("/v1").Handle("/:other", http.NotFoundHandler())
+
+	var errs RouteErrors
+	expect(t, errors.As(router.GetError(), &errs), true)
+	expect(t, len(errs), 2)
+	expect(t, errs[0].Path, "/api/:missing")
+	expect(t, errs[1].Path, "/api/v1/:other")
+	for i, err := range errs {
+		expect(t, filepath.Base(err.File), filepath.Base(file))
+		expect(t, err.Line, line+1+i)
+	}
+}
+
+func TestRouteErrorsNone(t *testing.T) {
+	router := New()
+	router.Verbose = false
+	router.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {}).Name("root")
+	expect(t, router.GetError(), nil)
+}
+
+func TestRouteErrorUnwrap(t *testing.T) {
+	base := errors.New("base")
+	err := newRouteError("/", base)
+	expect(t, errors.Is(err, base), true)
+	expect(t, errors.Is(RouteErrors{err}, base), true)
+}
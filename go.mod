@@ -1,5 +1,5 @@
 module github.com/nbari/violetear/v7
 
-go 1.16
+go 1.21
 
 require github.com/nbari/violetear v0.0.0-20210524103009-ce83b52538c9
@@ -0,0 +1,64 @@
+package violetear
+
+import (
+	"net/http"
+	"time"
+)
+
+// Group adds routes sharing a path prefix, middleware and timeout, example:
+//  api := router.Group("/api")
+//  api.Timeout(2 * time.Second).Use(auth)
+//  api.HandleFunc("/items", handleItems, "GET")
+//  api.HandleFunc("/reports", handleReports, "GET").Timeout(time.Minute)
+// The middleware and the timeout apply to the routes added after calling
+// Use and Timeout.
+type Group struct {
+	router     *Router
+	prefix     string
+	middleware []Middleware
+	timeout    time.Duration
+}
+
+// Group returns a Group adding routes to the router under prefix
+func (r *Router) Group(prefix string) *Group {
+	return &Group{router: r, prefix: prefix}
+}
+
+// Group returns a Group nested under g, it inherits the middleware and the
+// timeout of g
+func (g *Group) Group(prefix string) *Group {
+	return &Group{
+		router:     g.router,
+		prefix:     g.prefix + prefix,
+		middleware: append([]Middleware(nil), g.middleware...),
+		timeout:    g.timeout,
+	}
+}
+
+// Use appends middleware for the routes added to the group
+func (g *Group) Use(middleware ...Middleware) *Group {
+	g.middleware = append(g.middleware, middleware...)
+	return g
+}
+
+// Timeout sets the timeout of the routes added to the group, it can be
+// overridden per route using Route.Timeout
+func (g *Group) Timeout(d time.Duration) *Group {
+	g.timeout = d
+	return g
+}
+
+// Handle registers the handler for the prefix of the group followed by path,
+// see Router.Handle
+func (g *Group) Handle(path string, handler http.Handler, httpMethods ...string) *Route {
+	route := g.router.Handle(g.prefix+path, handler, httpMethods...)
+	if g.timeout > 0 {
+		route.Timeout(g.timeout)
+	}
+	return route.Use(g.middleware...)
+}
+
+// HandleFunc add a route to the group (path, http.HandlerFunc, methods)
+func (g *Group) HandleFunc(path string, handler http.HandlerFunc, httpMethods ...string) *Route {
+	return g.Handle(path, handler, httpMethods...)
+}
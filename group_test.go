@@ -0,0 +1,48 @@
+package violetear
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestGroup(t *testing.T) {
+	router := New()
+	router.Verbose = false
+	deadline := func(w http.ResponseWriter, r *http.Request) {
+		d, ok := r.Context().Deadline()
+		if !ok {
+			w.Write([]byte("none"))
+			return
+		}
+		if time.Until(d) > 10*time.Second {
+			w.Write([]byte("long"))
+			return
+		}
+		w.Write([]byte("short"))
+	}
+
+	api := router.Group("/api").Timeout(2 * time.Second).Use(tag("api"))
+	api.HandleFunc("/items", deadline, "GET")
+	api.HandleFunc("/reports", deadline, "GET").Timeout(time.Minute)
+	v2 := api.Group("/v2").Use(tag("v2"))
+	v2.HandleFunc("/items", deadline, "GET")
+	router.HandleFunc("/other", deadline, "GET")
+
+	tt := []struct {
+		path, body string
+	}{
+		{"/api/items", "api>short<api"},
+		{"/api/reports", "api>long<api"},
+		{"/api/v2/items", "api>v2>short<v2<api"},
+		{"/other", "none"},
+	}
+	for _, tc := range tt {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", tc.path, nil)
+		router.ServeHTTP(w, req)
+		expect(t, w.Code, http.StatusOK)
+		expect(t, w.Body.String(), tc.body)
+	}
+}
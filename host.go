@@ -0,0 +1,127 @@
+package violetear
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// host keeps a host pattern and the router handling its requests
+type host struct {
+	pattern string
+	labels  []string
+	dynamic bool
+	router  *Router
+}
+
+// Host returns a sub-router that handles only the requests for the given
+// host, labels can be dynamic using ":named" regular expressions added with
+// AddRegex, example:
+//  router.AddRegex(":tenant", `^[a-z]+$`)
+//  api := router.Host("api.example.com")
+//  tenant := router.Host(":tenant.example.com")
+//  tenant.HandleFunc("/", handler)
+// the value of the dynamic labels is available using GetParam("tenant", r).
+// Requests not matching any host are handled by the router itself.
+//
+// The sub-router shares the regular expressions and errors of the router and
+// inherits the handlers (NotFoundHandler, NotAllowedHandler, ...) configured
+// at the time Host is called.
+func (r *Router) Host(pattern string) *Router {
+	pattern = strings.ToLower(strings.TrimSuffix(strings.TrimSpace(pattern), "."))
+	t := r.table()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, h := range t.hosts {
+		if h.pattern == pattern {
+			return h.router
+		}
+	}
+
+	sub := r.derive(&table{
+		mu:            t.mu,
+		dynamicRoutes: t.dynamicRoutes,
+		routes:        &Trie{},
+	}, r.errs)
+	sub.host = pattern
+
+	h := &host{
+		pattern: pattern,
+		labels:  strings.Split(pattern, "."),
+		router:  sub,
+	}
+	for _, label := range h.labels {
+		if label == "" {
+			r.addError(pattern, errors.New("invalid host, empty label"))
+			return sub
+		}
+		if strings.HasPrefix(label, ":") {
+			if _, ok := t.dynamicRoutes[label]; !ok {
+				r.addError(pattern, fmt.Errorf("[%s] not found, need to add it using AddRegex(%q, `your regex`", label, label))
+				return sub
+			}
+			h.dynamic = true
+		}
+	}
+
+	// static hosts are matched before the dynamic ones
+	i := len(t.hosts)
+	if !h.dynamic {
+		for i = 0; i < len(t.hosts) && !t.hosts[i].dynamic; i++ {
+		}
+	}
+	t.hosts = append(t.hosts, nil)
+	copy(t.hosts[i+1:], t.hosts[i:])
+	t.hosts[i] = h
+	return sub
+}
+
+// matchHost returns the router handling the request host and the params
+// found in the dynamic labels, if no host matches nil is returned
+func (t *table) matchHost(req *http.Request) (*Router, Params) {
+	if len(t.hosts) == 0 {
+		return nil, nil
+	}
+	name := strings.ToLower(strings.TrimSuffix(stripPort(req.Host), "."))
+	labels := strings.Split(name, ".")
+	for _, h := range t.hosts {
+		if params, ok := h.match(labels, t.dynamicRoutes); ok {
+			return h.router, params
+		}
+	}
+	return nil, nil
+}
+
+// match check if the host labels match the pattern
+func (h *host) match(labels []string, dynamicRoutes dynamicSet) (Params, bool) {
+	if len(labels) != len(h.labels) {
+		return nil, false
+	}
+	var params Params
+	for i, label := range h.labels {
+		if !strings.HasPrefix(label, ":") {
+			if label != labels[i] {
+				return nil, false
+			}
+			continue
+		}
+		if !dynamicRoutes[label].MatchString(labels[i]) {
+			return nil, false
+		}
+		if params == nil {
+			params = Params{}
+		}
+		params.Add(label, labels[i])
+	}
+	return params, true
+}
+
+// stripPort removes the port from host if any
+func stripPort(hostport string) string {
+	if h, _, err := net.SplitHostPort(hostport); err == nil {
+		return h
+	}
+	return hostport
+}
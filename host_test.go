@@ -0,0 +1,88 @@
+package violetear
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHost(t *testing.T) {
+	router := New()
+	router.Verbose = false
+	router.AddRegex(":tenant", `^[a-z]+$`)
+	router.AddRegex(":id", `^\d+$`)
+
+	body := func(s string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(s + GetParam("tenant", r) + GetParam("id", r)))
+		}
+	}
+
+	router.HandleFunc("/", body("default"))
+	router.Host(":tenant.example.com").HandleFunc("/", body("tenant "))
+	router.Host(":tenant.example.com").HandleFunc("/item/:id", body("item "), "GET")
+	router.Host("api.example.com").HandleFunc("/", body("api"))
+	router.Host("Admin.Example.com.").HandleFunc("/", body("admin"))
+	expect(t, router.GetError(), nil)
+	expect(t, len(router.table().hosts), 3)
+	expect(t, router.table().hosts[2].pattern, ":tenant.example.com")
+
+	tt := []struct {
+		name string
+		host string
+		path string
+		body string
+		code int
+	}{
+		{"no host", "example.com", "/", "default", 200},
+		{"static", "api.example.com", "/", "api", 200},
+		{"static port", "api.example.com:8080", "/", "api", 200},
+		{"static case", "ADMIN.example.com", "/", "admin", 200},
+		{"dynamic", "foo.example.com", "/", "tenant foo", 200},
+		{"dynamic params", "foo.example.com", "/item/10", "item foo10", 200},
+		{"dynamic not found", "foo.example.com", "/not-found", "404 page not found\n", 404},
+		{"dynamic no match", "foo1.example.com", "/", "default", 200},
+		{"more labels", "a.b.example.com", "/", "default", 200},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", tc.path, nil)
+			req.Host = tc.host
+			router.ServeHTTP(w, req)
+			expect(t, w.Code, tc.code)
+			expect(t, w.Body.String(), tc.body)
+		})
+	}
+}
+
+func TestHostErrors(t *testing.T) {
+	router := New()
+	router.Verbose = false
+	sub := router.Host(":tenant.example.com")
+	expect(t, sub != nil, true)
+	expect(t, router.GetError() != nil, true)
+
+	router = New()
+	router.Verbose = false
+	router.Host("api..example.com")
+	expect(t, router.GetError() != nil, true)
+
+	router = New()
+	router.Verbose = false
+	router.Host("api.example.com").HandleFunc("/:none", func(w http.ResponseWriter, r *http.Request) {})
+	expect(t, router.GetError() != nil, true)
+}
+
+func TestHostNotFoundHandler(t *testing.T) {
+	router := New()
+	router.Verbose = false
+	router.NotFoundHandler = myMethodNotFound()
+	router.Host("api.example.com").HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {})
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/not-found", nil)
+	req.Host = "api.example.com"
+	router.ServeHTTP(w, req)
+	expect(t, w.Code, 404)
+	expect(t, w.Body.String(), "Not Found\n")
+}
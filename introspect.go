@@ -0,0 +1,81 @@
+package violetear
+
+// RouteStats reports the statistics kept by a middleware per route, example:
+// the queues of middleware.Concurrency
+type RouteStats interface {
+	// RouteStats returns the statistics of the route, nil if there are none
+	RouteStats(info *RouteInfo) interface{}
+}
+
+// RouteStatus a route of the router and the statistics reported for it
+type RouteStatus struct {
+	*RouteInfo
+
+	// Stats reported by the RouteStats added with AddStats, by name
+	Stats map[string]interface{}
+}
+
+// AddStats adds the statistics reported by s to the routes returned by
+// Routes under name, example:
+//  limiter := &middleware.Concurrency{Limit: 100, RouteLimit: 10}
+//  router.Use(limiter.Handler)
+//  router.AddStats("concurrency", limiter)
+func (r *Router) AddStats(name string, s RouteStats) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.stats == nil {
+		r.stats = map[string]RouteStats{}
+	}
+	r.stats[name] = s
+}
+
+// Routes returns the routes of the router followed by the routes of its
+// host sub-routers, a route with many methods is returned once
+func (r *Router) Routes() []RouteStatus {
+	var infos []*RouteInfo
+	t := r.table()
+	t.mu.RLock()
+	seen := map[*Route]bool{}
+	t.routes.walk(seen, &infos)
+	// the tables of the sub-routers share the mutex
+	for _, h := range t.hosts {
+		h.router.table().routes.walk(seen, &infos)
+	}
+	t.mu.RUnlock()
+
+	r.mu.Lock()
+	stats := make(map[string]RouteStats, len(r.stats))
+	for name, s := range r.stats {
+		stats[name] = s
+	}
+	r.mu.Unlock()
+
+	routes := make([]RouteStatus, len(infos))
+	for i, info := range infos {
+		routes[i].RouteInfo = info
+		for name, s := range stats {
+			if v := s.RouteStats(info); v != nil {
+				if routes[i].Stats == nil {
+					routes[i].Stats = map[string]interface{}{}
+				}
+				routes[i].Stats[name] = v
+			}
+		}
+	}
+	return routes
+}
+
+// walk appends the info of the routes of the node and its children, seen
+// keeps the routes already found
+func (t *Trie) walk(seen map[*Route]bool, infos *[]*RouteInfo) {
+	for _, h := range t.Handler {
+		if h.route == nil || h.route.info == nil || seen[h.route] {
+			continue
+		}
+		seen[h.route] = true
+		*infos = append(*infos, h.route.info)
+	}
+	for _, n := range t.Node {
+		n.walk(seen, infos)
+	}
+}
@@ -0,0 +1,63 @@
+package violetear
+
+import (
+	"net/http"
+	"testing"
+)
+
+// countStats reports the number of methods of the routes
+type countStats struct{}
+
+func (countStats) RouteStats(info *RouteInfo) interface{} {
+	if info.Pattern == "/none" {
+		return nil
+	}
+	return len(info.Methods)
+}
+
+func TestRouterRoutes(t *testing.T) {
+	router := New()
+	router.Verbose = false
+	router.AddRegex(":id", `^\d+$`)
+	h := func(w http.ResponseWriter, r *http.Request) {}
+	router.HandleFunc("/", h)
+	router.HandleFunc("/item/:id", h, "GET,HEAD").Name("item")
+	router.HandleFunc("/item/:id", h, "PUT")
+	router.HandleFunc("/none", h, "GET")
+	router.Host("api.example.com").HandleFunc("/status", h, "GET")
+
+	routes := router.Routes()
+	expect(t, len(routes), 5)
+	for _, route := range routes {
+		expect(t, route.Stats == nil, true)
+	}
+
+	router.AddStats("methods", countStats{})
+	expected := map[string]interface{}{
+		"/ ALL":                      1,
+		"/item/:id GET,HEAD item":    2,
+		"/item/:id PUT item":         1,
+		"/none GET":                  nil,
+		"api.example.com/status GET": 1,
+	}
+	for _, route := range router.Routes() {
+		k := route.Host + route.Pattern
+		for i, m := range route.Methods {
+			if i == 0 {
+				k += " " + m
+			} else {
+				k += "," + m
+			}
+		}
+		if route.Name != "" {
+			k += " " + route.Name
+		}
+		v, ok := expected[k]
+		expect(t, ok, true)
+		if v == nil {
+			expect(t, route.Stats == nil, true)
+			continue
+		}
+		expect(t, route.Stats["methods"], v)
+	}
+}
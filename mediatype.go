@@ -0,0 +1,135 @@
+package violetear
+
+import (
+	"fmt"
+	"mime"
+	"strconv"
+	"strings"
+)
+
+// acceptRange is a media range from the Accept header and its quality value
+type acceptRange struct {
+	mediaType string
+	q         float64
+}
+
+// parseMediaTypes parses a media type constraint declared in Handle, for
+// example: "Content-Type: application/json, multipart/form-data"
+func parseMediaTypes(constraint string) (header string, types []string, err error) {
+	i := strings.Index(constraint, ":")
+	if i == -1 {
+		return "", nil, fmt.Errorf("invalid media type constraint %q, expected \"Content-Type: type/subtype\" or \"Accept: type/subtype\"", constraint)
+	}
+	header = strings.ToLower(strings.TrimSpace(constraint[:i]))
+	if header != "content-type" && header != "accept" {
+		return "", nil, fmt.Errorf("invalid media type constraint %q, only Content-Type and Accept are supported", constraint)
+	}
+	for _, v := range strings.Split(constraint[i+1:], ",") {
+		v = strings.ToLower(strings.TrimSpace(v))
+		if v == "" {
+			continue
+		}
+		if !strings.Contains(v, "/") {
+			return "", nil, fmt.Errorf("invalid media type %q in %q", v, constraint)
+		}
+		types = append(types, v)
+	}
+	if len(types) == 0 {
+		return "", nil, fmt.Errorf("no media types found in %q", constraint)
+	}
+	return header, types, nil
+}
+
+// matchMediaType check if mediaType matches pattern, pattern can use
+// wildcards like "*/*" or "text/*"
+func matchMediaType(pattern, mediaType string) bool {
+	if pattern == "*/*" || pattern == mediaType {
+		return true
+	}
+	if strings.HasSuffix(pattern, "/*") {
+		return strings.HasPrefix(mediaType, pattern[:len(pattern)-1])
+	}
+	return false
+}
+
+// matchContentType check if the request Content-Type is one of the declared
+// types, if no types are declared any Content-Type is accepted
+func matchContentType(types []string, contentType string) bool {
+	if len(types) == 0 {
+		return true
+	}
+	if contentType == "" {
+		return false
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	for _, t := range types {
+		if matchMediaType(t, mediaType) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseAccept returns the media ranges of the Accept header
+func parseAccept(accept string) []acceptRange {
+	var ranges []acceptRange
+	for _, part := range strings.Split(accept, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		ar := acceptRange{q: 1}
+		params := strings.Split(part, ";")
+		ar.mediaType = strings.ToLower(strings.TrimSpace(params[0]))
+		for _, p := range params[1:] {
+			p = strings.TrimSpace(p)
+			if strings.HasPrefix(p, "q=") {
+				if q, err := strconv.ParseFloat(p[2:], 64); err == nil {
+					ar.q = q
+				}
+			}
+		}
+		ranges = append(ranges, ar)
+	}
+	return ranges
+}
+
+// acceptQuality returns the highest quality value the client gives to any
+// of the declared types, the most specific media range wins:
+// "text/csv" > "text/*" > "*/*". If no types are declared 0 is returned so
+// that handlers declaring acceptable types are preferred, -1 means not
+// acceptable.
+func acceptQuality(types []string, ranges []acceptRange) float64 {
+	if len(types) == 0 {
+		return 0
+	}
+	// no Accept header, client accepts any media type
+	if ranges == nil {
+		return 1
+	}
+	best := -1.0
+	for _, t := range types {
+		q, specificity := -1.0, -1
+		for _, ar := range ranges {
+			if !matchMediaType(ar.mediaType, t) {
+				continue
+			}
+			s := 2
+			if ar.mediaType == "*/*" {
+				s = 0
+			} else if strings.HasSuffix(ar.mediaType, "/*") {
+				s = 1
+			}
+			if s > specificity {
+				q, specificity = ar.q, s
+			}
+		}
+		if q > 0 && q > best {
+			best = q
+		}
+	}
+	return best
+}
@@ -0,0 +1,80 @@
+package violetear
+
+import (
+	"testing"
+)
+
+func TestParseMediaTypes(t *testing.T) {
+	tt := []struct {
+		name       string
+		constraint string
+		header     string
+		types      int
+		err        bool
+	}{
+		{"content-type", "Content-Type: application/json", "content-type", 1, false},
+		{"content-type multiple", "content-type: application/json, multipart/form-data", "content-type", 2, false},
+		{"accept", "Accept: text/csv,application/json", "accept", 2, false},
+		{"no colon", "application/json", "", 0, true},
+		{"unknown header", "X-Type: application/json", "", 0, true},
+		{"no types", "Accept: ", "", 0, true},
+		{"bad type", "Accept: json", "", 0, true},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			header, types, err := parseMediaTypes(tc.constraint)
+			expect(t, err != nil, tc.err)
+			expect(t, header, tc.header)
+			expect(t, len(types), tc.types)
+		})
+	}
+}
+
+func TestMatchContentType(t *testing.T) {
+	tt := []struct {
+		name        string
+		types       []string
+		contentType string
+		match       bool
+	}{
+		{"any", nil, "", true},
+		{"any with type", nil, "text/plain", true},
+		{"missing", []string{"application/json"}, "", false},
+		{"exact", []string{"application/json"}, "application/json", true},
+		{"params", []string{"application/json"}, "application/json; charset=utf-8", true},
+		{"case", []string{"application/json"}, "Application/JSON", true},
+		{"boundary", []string{"application/json", "multipart/form-data"}, "multipart/form-data; boundary=xyz", true},
+		{"wildcard", []string{"text/*"}, "text/csv", true},
+		{"no match", []string{"application/json"}, "application/x-protobuf", false},
+		{"invalid", []string{"application/json"}, "application/json;;", false},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			expect(t, matchContentType(tc.types, tc.contentType), tc.match)
+		})
+	}
+}
+
+func TestAcceptQuality(t *testing.T) {
+	tt := []struct {
+		name   string
+		types  []string
+		accept string
+		q      float64
+	}{
+		{"no types", nil, "text/csv", 0},
+		{"no accept", []string{"text/csv"}, "", 1},
+		{"exact", []string{"text/csv"}, "text/csv", 1},
+		{"any", []string{"text/csv"}, "*/*", 1},
+		{"subtype wildcard", []string{"text/csv"}, "text/*;q=0.5", 0.5},
+		{"most specific wins", []string{"text/csv"}, "text/*;q=0.5, text/csv;q=0.8, */*;q=0.1", 0.8},
+		{"excluded", []string{"text/csv"}, "text/csv;q=0, */*", -1},
+		{"not acceptable", []string{"application/json"}, "text/csv", -1},
+		{"best type", []string{"application/json", "text/csv"}, "application/json;q=0.2, text/csv", 1},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			expect(t, acceptQuality(tc.types, parseAccept(tc.accept)), tc.q)
+		})
+	}
+}
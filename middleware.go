@@ -0,0 +1,137 @@
+package violetear
+
+import (
+	"context"
+	"net/http"
+)
+
+// Middleware pattern for all middleware, same as middleware.Constructor
+type Middleware func(http.Handler) http.Handler
+
+// chain keeps the router middleware and the handler built with them
+type chain struct {
+	middleware []Middleware
+	handler    http.Handler
+}
+
+// matched keeps the handler found for the request and the router where it
+// was found, used by the handler at the end of the router middleware chain
+type matched struct {
+	handler http.Handler
+	router  *Router
+}
+
+// Use appends middleware to the router, they wrap every handler including
+// the NotFoundHandler, NotAllowedHandler and PanicHandler, example:
+//  router.Use(commonHeaders, middlewareOne)
+// is equivalent to wrapping every handler with:
+//  middleware.New(commonHeaders, middlewareOne).Then(handler)
+// The middleware run after the route is matched, therefore the params and
+// the route name are available in the request context.
+func (r *Router) Use(middleware ...Middleware) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	c := &chain{}
+	if current := r.chain(); current != nil {
+		c.middleware = append(c.middleware, current.middleware...)
+	}
+	c.middleware = append(c.middleware, middleware...)
+	c.handler = wrap(http.HandlerFunc(r.dispatchMatched), c.middleware)
+	r.middleware.Store(c)
+}
+
+// chain returns the router middleware chain, nil if Use was never called
+func (r *Router) chain() *chain {
+	c, _ := r.middleware.Load().(*chain)
+	return c
+}
+
+// Pre appends middleware that run before the route is matched, they can
+// rewrite the request (path, host, headers) used to find the route or
+// respond without calling the next handler to stop the request, example:
+//  router.Pre(func(next http.Handler) http.Handler {
+//      return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+//          r2 := r.Clone(r.Context())
+//          r2.URL.Path = strings.TrimPrefix(r.URL.Path, "/en")
+//          next.ServeHTTP(w, r2)
+//      })
+//  })
+// The middleware are only used by the router serving the request, not by
+// the host sub-routers.
+func (r *Router) Pre(middleware ...Middleware) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	c := &chain{}
+	if current, _ := r.pre.Load().(*chain); current != nil {
+		c.middleware = append(c.middleware, current.middleware...)
+	}
+	c.middleware = append(c.middleware, middleware...)
+	c.handler = wrap(http.HandlerFunc(r.routeRequest), c.middleware)
+	r.pre.Store(c)
+}
+
+// preRoute serves the request through the middleware added with Pre
+func (r *Router) preRoute(w http.ResponseWriter, req *http.Request) {
+	if c, _ := r.pre.Load().(*chain); c != nil {
+		c.handler.ServeHTTP(w, req)
+		return
+	}
+	r.routeRequest(w, req)
+}
+
+// dispatchMatched serves the handler found for the request, if it was found
+// in a host sub-router with its own middleware, the request goes through
+// them first
+func (r *Router) dispatchMatched(w http.ResponseWriter, req *http.Request) {
+	m := req.Context().Value(matchedKey).(*matched)
+	if m.router != r {
+		if c := m.router.chain(); c != nil {
+			c.handler.ServeHTTP(w, req)
+			return
+		}
+	}
+	m.handler.ServeHTTP(w, req)
+}
+
+// serve dispatches the request to handler h found in router through the
+// middleware
+func (r *Router) serve(w http.ResponseWriter, req *http.Request, h http.Handler, router *Router) {
+	c := r.chain()
+	if c == nil && router != r {
+		c = router.chain()
+	}
+	if c == nil {
+		h.ServeHTTP(w, req)
+		return
+	}
+	req = req.WithContext(context.WithValue(req.Context(), matchedKey, &matched{h, router}))
+	c.handler.ServeHTTP(w, req)
+}
+
+// wrap returns h wrapped by the middleware, the first one is the outermost
+func wrap(h http.Handler, middleware []Middleware) http.Handler {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		h = middleware[i](h)
+	}
+	return h
+}
+
+// Use appends middleware to the route handler, example:
+//  router.HandleFunc("/", handler).Use(m1, m2)
+// is equivalent to:
+//  router.Handle("/", middleware.New(m1, m2).Then(handler))
+func (r *Route) Use(middleware ...Middleware) *Route {
+	if !r.added {
+		return r
+	}
+	r.table.mu.Lock()
+	defer r.table.mu.Unlock()
+	r.middleware = append(r.middleware, middleware...)
+	h := wrap(r.handler, r.middleware)
+	for i := range r.Trie.Handler {
+		if r.Trie.Handler[i].route == r {
+			r.Trie.Handler[i].Handler = h
+		}
+	}
+	return r
+}
@@ -0,0 +1,410 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Principal the client authenticated by BasicAuth, BearerAuth, APIKeyAuth or
+// HMACAuth, available in the request context using GetPrincipal
+type Principal struct {
+	// Scheme used to authenticate: Basic, Bearer, APIKey or HMAC
+	Scheme string
+
+	// ID of the client, example: the user name or the subject of the token
+	ID string
+
+	// Data returned by the verifier, example: the claims of the token
+	Data interface{}
+}
+
+// contextKey type of the context keys of the package
+type contextKey int
+
+// principalKey context key of the Principal
+const principalKey contextKey = 0
+
+// GetPrincipal returns the authenticated client, nil if the request was not
+// authenticated
+func GetPrincipal(r *http.Request) *Principal {
+	if p, ok := r.Context().Value(principalKey).(*Principal); ok {
+		return p
+	}
+	return nil
+}
+
+// withPrincipal returns the request with the principal in its context
+func withPrincipal(r *http.Request, p *Principal) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), principalKey, p))
+}
+
+// unauthorized responds with the handler or 401 Unauthorized, challenge is
+// the value of the WWW-Authenticate header
+func unauthorized(w http.ResponseWriter, r *http.Request, handler http.Handler, challenge string) {
+	if challenge != "" {
+		w.Header().Set("WWW-Authenticate", challenge)
+	}
+	if handler != nil {
+		handler.ServeHTTP(w, r)
+		return
+	}
+	http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+}
+
+// secureCompare compares a and b in constant time, also when their lengths
+// differ
+func secureCompare(a, b string) bool {
+	ha, hb := sha256.Sum256([]byte(a)), sha256.Sum256([]byte(b))
+	return subtle.ConstantTimeCompare(ha[:], hb[:]) == 1
+}
+
+// BasicAuth HTTP Basic authentication, example:
+//  auth := &middleware.BasicAuth{
+//      Realm: "admin",
+//      Users: map[string]string{"admin": os.Getenv("ADMIN_PASSWORD")},
+//  }
+//  router.HandleFunc("/admin", handleAdmin).Use(auth.Handler)
+// The Principal ID is the user name.
+type BasicAuth struct {
+	// Realm sent in the WWW-Authenticate header, "Restricted" by default
+	Realm string
+
+	// Users user names and passwords, compared in constant time, the users
+	// with an empty password can't log in
+	Users map[string]string
+
+	// Validator reports whether the credentials are valid, used instead of
+	// Users, it must compare them in constant time
+	Validator func(user, password string, r *http.Request) bool
+
+	// UnauthorizedHandler called when the credentials are missing or not
+	// valid, 401 Unauthorized by default
+	UnauthorizedHandler http.Handler
+}
+
+// Handler middleware authenticating the requests, it panics if Users and
+// Validator are not set
+func (a *BasicAuth) Handler(next http.Handler) http.Handler {
+	if len(a.Users) == 0 && a.Validator == nil {
+		panic("auth: BasicAuth requires Users or Validator")
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, password, ok := r.BasicAuth()
+		if !ok || !a.valid(user, password, r) {
+			realm := a.Realm
+			if realm == "" {
+				realm = "Restricted"
+			}
+			unauthorized(w, r, a.UnauthorizedHandler, "Basic realm="+strconv.Quote(realm)+", charset=\"UTF-8\"")
+			return
+		}
+		next.ServeHTTP(w, withPrincipal(r, &Principal{Scheme: "Basic", ID: user}))
+	})
+}
+
+// valid reports whether the credentials are valid
+func (a *BasicAuth) valid(user, password string, r *http.Request) bool {
+	if a.Validator != nil {
+		return a.Validator(user, password, r)
+	}
+	expected, ok := a.Users[user]
+	// compare even if the user doesn't exist to not reveal it, an empty
+	// password is a missing one, example: an unset environment variable
+	return secureCompare(password, expected) && ok && expected != ""
+}
+
+// BearerAuth authenticates the requests with a token in the Authorization
+// header, example:
+//  auth := &middleware.BearerAuth{
+//      Verify: func(ctx context.Context, token string) (*middleware.Principal, error) {
+//          claims, err := verifyJWT(token)
+//          if err != nil {
+//              return nil, err
+//          }
+//          return &middleware.Principal{ID: claims.Subject, Data: claims}, nil
+//      },
+//  }
+//  router.Use(auth.Handler)
+type BearerAuth struct {
+	// Realm sent in the WWW-Authenticate header, omitted if empty
+	Realm string
+
+	// Verify returns the Principal of the token, an error if it is not
+	// valid
+	Verify func(ctx context.Context, token string) (*Principal, error)
+
+	// UnauthorizedHandler called when the token is missing or not valid,
+	// 401 Unauthorized by default
+	UnauthorizedHandler http.Handler
+}
+
+// Handler middleware authenticating the requests, it panics if Verify is
+// not set
+func (a *BearerAuth) Handler(next http.Handler) http.Handler {
+	if a.Verify == nil {
+		panic("auth: BearerAuth requires Verify")
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		challenge := "Bearer"
+		if a.Realm != "" {
+			challenge += " realm=" + strconv.Quote(a.Realm)
+		}
+		auth := r.Header.Get("Authorization")
+		if len(auth) < 7 || !strings.EqualFold(auth[:7], "Bearer ") || strings.TrimSpace(auth[7:]) == "" {
+			unauthorized(w, r, a.UnauthorizedHandler, challenge)
+			return
+		}
+		p, err := a.Verify(r.Context(), strings.TrimSpace(auth[7:]))
+		if err != nil || p == nil {
+			if a.Realm != "" {
+				challenge += ","
+			}
+			unauthorized(w, r, a.UnauthorizedHandler, challenge+` error="invalid_token"`)
+			return
+		}
+		if p.Scheme == "" {
+			p.Scheme = "Bearer"
+		}
+		next.ServeHTTP(w, withPrincipal(r, p))
+	})
+}
+
+// APIKeyAuth authenticates the requests with a key sent in a header or a
+// query parameter, example:
+//  auth := &middleware.APIKeyAuth{
+//      Keys: map[string]string{os.Getenv("PARTNER_KEY"): "partner"},
+//  }
+//  router.Use(auth.Handler)
+type APIKeyAuth struct {
+	// Header containing the key, "X-API-Key" by default
+	Header string
+
+	// Query parameter containing the key, used when the header is not
+	// present, disabled if empty
+	Query string
+
+	// Keys the valid keys and the Principal ID of each one, compared in
+	// constant time
+	Keys map[string]string
+
+	// Verify returns the Principal of the key, an error if it is not valid,
+	// used instead of Keys
+	Verify func(ctx context.Context, key string) (*Principal, error)
+
+	// UnauthorizedHandler called when the key is missing or not valid, 401
+	// Unauthorized by default
+	UnauthorizedHandler http.Handler
+}
+
+// Handler middleware authenticating the requests, it panics if Keys and
+// Verify are not set
+func (a *APIKeyAuth) Handler(next http.Handler) http.Handler {
+	if len(a.Keys) == 0 && a.Verify == nil {
+		panic("auth: APIKeyAuth requires Keys or Verify")
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header := a.Header
+		if header == "" {
+			header = "X-API-Key"
+		}
+		key := r.Header.Get(header)
+		if key == "" && a.Query != "" {
+			key = r.URL.Query().Get(a.Query)
+		}
+		if key == "" {
+			unauthorized(w, r, a.UnauthorizedHandler, "")
+			return
+		}
+		p, err := a.verify(r.Context(), key)
+		if err != nil {
+			unauthorized(w, r, a.UnauthorizedHandler, "")
+			return
+		}
+		if p.Scheme == "" {
+			p.Scheme = "APIKey"
+		}
+		next.ServeHTTP(w, withPrincipal(r, p))
+	})
+}
+
+// errInvalidKey returned when the key is not valid
+var errInvalidKey = errors.New("auth: invalid key")
+
+// verify returns the Principal of the key
+func (a *APIKeyAuth) verify(ctx context.Context, key string) (*Principal, error) {
+	if a.Verify != nil {
+		p, err := a.Verify(ctx, key)
+		if err == nil && p == nil {
+			err = errInvalidKey
+		}
+		return p, err
+	}
+	// all the keys are compared to not reveal which one matched
+	var id string
+	found := false
+	for k, v := range a.Keys {
+		if secureCompare(key, k) {
+			id, found = v, true
+		}
+	}
+	if !found {
+		return nil, errInvalidKey
+	}
+	return &Principal{ID: id}, nil
+}
+
+// HMACAuth verifies the HMAC signature of the requests, example: webhooks,
+// the signature is computed over the body, prefixed by the timestamp and a
+// dot when TimestampHeader is set, example:
+//  auth := &middleware.HMACAuth{
+//      Secret:          []byte(os.Getenv("WEBHOOK_SECRET")),
+//      TimestampHeader: "X-Timestamp",
+//  }
+//  router.HandleFunc("/webhook", handleWebhook, "POST").Use(auth.Handler)
+// The signature is hex encoded, optionally prefixed by the algorithm,
+// example: sha256=5d41402a...
+type HMACAuth struct {
+	// Header containing the signature, "X-Signature" by default
+	Header string
+
+	// TimestampHeader containing the time of the request in Unix seconds,
+	// the timestamp is signed and checked against MaxSkew, not used if empty
+	TimestampHeader string
+
+	// MaxSkew difference allowed between the timestamp and the current
+	// time, 5 minutes by default
+	MaxSkew time.Duration
+
+	// Secret used to sign the requests
+	Secret []byte
+
+	// SecretFunc returns the Principal ID and the secret of the request,
+	// example: looking up the sender, used instead of Secret, the requests
+	// are rejected if the secret is empty
+	SecretFunc func(r *http.Request) (id string, secret []byte, err error)
+
+	// Hash sha256.New by default
+	Hash func() hash.Hash
+
+	// MaxBodySize bytes of the body read to verify the signature, 1MB by
+	// default, bigger bodies get 413 Request Entity Too Large
+	MaxBodySize int64
+
+	// UnauthorizedHandler called when the signature is missing or not
+	// valid, 401 Unauthorized by default
+	UnauthorizedHandler http.Handler
+
+	now func() time.Time
+}
+
+// Handler middleware verifying the signature of the requests, it panics if
+// Secret and SecretFunc are not set
+func (a *HMACAuth) Handler(next http.Handler) http.Handler {
+	if len(a.Secret) == 0 && a.SecretFunc == nil {
+		panic("auth: HMACAuth requires Secret or SecretFunc")
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header := a.Header
+		if header == "" {
+			header = "X-Signature"
+		}
+		signature := r.Header.Get(header)
+		// algorithm prefix, example: sha256=
+		if i := strings.IndexByte(signature, '='); i != -1 {
+			signature = signature[i+1:]
+		}
+		sig, err := hex.DecodeString(signature)
+		if err != nil || len(sig) == 0 {
+			unauthorized(w, r, a.UnauthorizedHandler, "")
+			return
+		}
+
+		var timestamp string
+		if a.TimestampHeader != "" {
+			timestamp = r.Header.Get(a.TimestampHeader)
+			if !a.validTimestamp(timestamp) {
+				unauthorized(w, r, a.UnauthorizedHandler, "")
+				return
+			}
+		}
+
+		id, secret := "", a.Secret
+		if a.SecretFunc != nil {
+			if id, secret, err = a.SecretFunc(r); err != nil {
+				unauthorized(w, r, a.UnauthorizedHandler, "")
+				return
+			}
+		}
+		// anyone can sign using an empty key
+		if len(secret) == 0 {
+			unauthorized(w, r, a.UnauthorizedHandler, "")
+			return
+		}
+
+		// read the body to sign it, the handler gets a copy
+		maxSize := a.MaxBodySize
+		if maxSize <= 0 {
+			maxSize = 1 << 20
+		}
+		var body []byte
+		if r.Body != nil {
+			body, err = io.ReadAll(http.MaxBytesReader(w, r.Body, maxSize))
+			if err != nil {
+				var mbe *http.MaxBytesError
+				if errors.As(err, &mbe) {
+					http.Error(w, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+					return
+				}
+				http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+				return
+			}
+		}
+
+		h := a.Hash
+		if h == nil {
+			h = sha256.New
+		}
+		mac := hmac.New(h, secret)
+		if timestamp != "" {
+			mac.Write([]byte(timestamp + "."))
+		}
+		mac.Write(body)
+		if !hmac.Equal(mac.Sum(nil), sig) {
+			unauthorized(w, r, a.UnauthorizedHandler, "")
+			return
+		}
+
+		r = withPrincipal(r, &Principal{Scheme: "HMAC", ID: id})
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		next.ServeHTTP(w, r)
+	})
+}
+
+// validTimestamp reports whether the timestamp is within MaxSkew
+func (a *HMACAuth) validTimestamp(timestamp string) bool {
+	sec, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return false
+	}
+	now := time.Now
+	if a.now != nil {
+		now = a.now
+	}
+	skew := a.MaxSkew
+	if skew <= 0 {
+		skew = 5 * time.Minute
+	}
+	d := now().Sub(time.Unix(sec, 0))
+	return d <= skew && d >= -skew
+}
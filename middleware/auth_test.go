@@ -0,0 +1,306 @@
+package middleware
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// whoami responds with the scheme and ID of the principal
+var whoami = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	p := GetPrincipal(r)
+	if p == nil {
+		w.Write([]byte("nobody"))
+		return
+	}
+	w.Write([]byte(p.Scheme + ":" + p.ID))
+})
+
+func TestGetPrincipal(t *testing.T) {
+	w := httptest.NewRecorder()
+	whoami.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if w.Body.String() != "nobody" {
+		t.Errorf("expected nobody, got %q", w.Body.String())
+	}
+}
+
+func TestBasicAuth(t *testing.T) {
+	auth := &BasicAuth{Realm: "admin", Users: map[string]string{"alice": "secret", "admin": ""}}
+	h := auth.Handler(whoami)
+
+	tt := []struct {
+		name           string
+		user, password string
+		code           int
+		body           string
+	}{
+		{"valid", "alice", "secret", 200, "Basic:alice"},
+		{"wrong password", "alice", "secreT", 401, "Unauthorized\n"},
+		{"unknown user", "bob", "secret", 401, "Unauthorized\n"},
+		{"empty password", "admin", "", 401, "Unauthorized\n"},
+		{"missing", "", "", 401, "Unauthorized\n"},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest("GET", "/", nil)
+			if tc.user != "" {
+				req.SetBasicAuth(tc.user, tc.password)
+			}
+			h.ServeHTTP(w, req)
+			if w.Code != tc.code {
+				t.Errorf("expected status %d, got %d", tc.code, w.Code)
+			}
+			if w.Body.String() != tc.body {
+				t.Errorf("expected body %q, got %q", tc.body, w.Body.String())
+			}
+			if tc.code == 401 && w.Header().Get("WWW-Authenticate") != `Basic realm="admin", charset="UTF-8"` {
+				t.Errorf("unexpected WWW-Authenticate %q", w.Header().Get("WWW-Authenticate"))
+			}
+		})
+	}
+
+	auth = &BasicAuth{Validator: func(user, password string, r *http.Request) bool {
+		return user == "bob" && password == "pass"
+	}}
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/", nil)
+	req.SetBasicAuth("bob", "pass")
+	auth.Handler(whoami).ServeHTTP(w, req)
+	if w.Body.String() != "Basic:bob" {
+		t.Errorf("expected Basic:bob, got %q", w.Body.String())
+	}
+}
+
+func TestBearerAuth(t *testing.T) {
+	auth := &BearerAuth{
+		Realm: "api",
+		Verify: func(ctx context.Context, token string) (*Principal, error) {
+			if token != "good" {
+				return nil, errors.New("invalid")
+			}
+			return &Principal{ID: "svc", Data: map[string]string{"scope": "read"}}, nil
+		},
+	}
+	h := auth.Handler(whoami)
+
+	tt := []struct {
+		name, header, challenge string
+		code                    int
+	}{
+		{"valid", "Bearer good", "", 200},
+		{"lowercase", "bearer good", "", 200},
+		{"invalid", "Bearer bad", `Bearer realm="api", error="invalid_token"`, 401},
+		{"empty", "Bearer ", `Bearer realm="api"`, 401},
+		{"basic", "Basic Zm9vOmJhcg==", `Bearer realm="api"`, 401},
+		{"missing", "", `Bearer realm="api"`, 401},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest("GET", "/", nil)
+			if tc.header != "" {
+				req.Header.Set("Authorization", tc.header)
+			}
+			h.ServeHTTP(w, req)
+			if w.Code != tc.code {
+				t.Errorf("expected status %d, got %d", tc.code, w.Code)
+			}
+			if c := w.Header().Get("WWW-Authenticate"); c != tc.challenge {
+				t.Errorf("expected WWW-Authenticate %q, got %q", tc.challenge, c)
+			}
+			if tc.code == 200 && w.Body.String() != "Bearer:svc" {
+				t.Errorf("unexpected body %q", w.Body.String())
+			}
+		})
+	}
+}
+
+func TestAPIKeyAuth(t *testing.T) {
+	auth := &APIKeyAuth{
+		Query: "api_key",
+		Keys:  map[string]string{"k1": "partner", "k2": "internal"},
+		UnauthorizedHandler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusForbidden)
+		}),
+	}
+	h := auth.Handler(whoami)
+
+	tt := []struct {
+		name, header, url string
+		code              int
+		body              string
+	}{
+		{"header", "k1", "/", 200, "APIKey:partner"},
+		{"query", "", "/?api_key=k2", 200, "APIKey:internal"},
+		{"header first", "k1", "/?api_key=k2", 200, "APIKey:partner"},
+		{"invalid", "k3", "/", 403, ""},
+		{"missing", "", "/", 403, ""},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest("GET", tc.url, nil)
+			if tc.header != "" {
+				req.Header.Set("X-API-Key", tc.header)
+			}
+			h.ServeHTTP(w, req)
+			if w.Code != tc.code {
+				t.Errorf("expected status %d, got %d", tc.code, w.Code)
+			}
+			if w.Body.String() != tc.body {
+				t.Errorf("expected body %q, got %q", tc.body, w.Body.String())
+			}
+		})
+	}
+
+	auth = &APIKeyAuth{
+		Header: "Api-Token",
+		Verify: func(ctx context.Context, key string) (*Principal, error) {
+			if key == "token" {
+				return &Principal{ID: "verified"}, nil
+			}
+			return nil, nil
+		},
+	}
+	for key, body := range map[string]string{"token": "APIKey:verified", "other": "Unauthorized\n"} {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("Api-Token", key)
+		auth.Handler(whoami).ServeHTTP(w, req)
+		if w.Body.String() != body {
+			t.Errorf("expected body %q, got %q", body, w.Body.String())
+		}
+	}
+}
+
+func TestHMACAuth(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	secret := []byte("webhook secret")
+	sign := func(timestamp, body string) string {
+		mac := hmac.New(sha256.New, secret)
+		if timestamp != "" {
+			mac.Write([]byte(timestamp + "."))
+		}
+		mac.Write([]byte(body))
+		return hex.EncodeToString(mac.Sum(nil))
+	}
+	echo := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		w.Write([]byte(GetPrincipal(r).Scheme + ":" + string(b)))
+	})
+	auth := &HMACAuth{
+		Secret:          secret,
+		TimestampHeader: "X-Timestamp",
+		MaxBodySize:     20,
+		now:             func() time.Time { return now },
+	}
+	h := auth.Handler(echo)
+	ts := strconv.FormatInt(now.Unix(), 10)
+	old := strconv.FormatInt(now.Add(-6*time.Minute).Unix(), 10)
+
+	tt := []struct {
+		name, body, timestamp, signature string
+		code                             int
+	}{
+		{"valid", `{"event":"push"}`, ts, sign(ts, `{"event":"push"}`), 200},
+		{"prefixed", `{"event":"push"}`, ts, "sha256=" + sign(ts, `{"event":"push"}`), 200},
+		{"tampered", `{"event":"pull"}`, ts, sign(ts, `{"event":"push"}`), 401},
+		{"old timestamp", `{"event":"push"}`, old, sign(old, `{"event":"push"}`), 401},
+		{"missing timestamp", `{"event":"push"}`, "", sign("", `{"event":"push"}`), 401},
+		{"missing signature", `{"event":"push"}`, ts, "", 401},
+		{"not hex", `{"event":"push"}`, ts, "zz", 401},
+		{"too big", strings.Repeat("a", 21), ts, sign(ts, strings.Repeat("a", 21)), 413},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest("POST", "/webhook", strings.NewReader(tc.body))
+			if tc.timestamp != "" {
+				req.Header.Set("X-Timestamp", tc.timestamp)
+			}
+			if tc.signature != "" {
+				req.Header.Set("X-Signature", tc.signature)
+			}
+			h.ServeHTTP(w, req)
+			if w.Code != tc.code {
+				t.Errorf("expected status %d, got %d", tc.code, w.Code)
+			}
+			if tc.code == 200 && w.Body.String() != "HMAC:"+tc.body {
+				t.Errorf("unexpected body %q", w.Body.String())
+			}
+		})
+	}
+
+	// secret per sender, no timestamp
+	auth = &HMACAuth{
+		Header: "X-Hub-Signature-256",
+		SecretFunc: func(r *http.Request) (string, []byte, error) {
+			if r.Header.Get("X-Sender") != "github" {
+				return "", nil, errors.New("unknown sender")
+			}
+			return "github", secret, nil
+		},
+	}
+	for sender, code := range map[string]int{"github": 200, "other": 401} {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/webhook", strings.NewReader("payload"))
+		req.Header.Set("X-Sender", sender)
+		req.Header.Set("X-Hub-Signature-256", "sha256="+sign("", "payload"))
+		auth.Handler(whoami).ServeHTTP(w, req)
+		if w.Code != code {
+			t.Errorf("%s: expected status %d, got %d", sender, code, w.Code)
+		}
+		if code == 200 && w.Body.String() != "HMAC:github" {
+			t.Errorf("unexpected body %q", w.Body.String())
+		}
+	}
+
+	// empty secret, signed with an empty key
+	mac := hmac.New(sha256.New, nil)
+	mac.Write([]byte("payload"))
+	empty := hex.EncodeToString(mac.Sum(nil))
+	auth = &HMACAuth{SecretFunc: func(r *http.Request) (string, []byte, error) {
+		return "anyone", nil, nil
+	}}
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "/webhook", strings.NewReader("payload"))
+	req.Header.Set("X-Signature", empty)
+	auth.Handler(whoami).ServeHTTP(w, req)
+	if w.Code != 401 {
+		t.Errorf("expected status 401, got %d", w.Code)
+	}
+}
+
+func TestAuthConfig(t *testing.T) {
+	tt := []struct {
+		name string
+		auth interface {
+			Handler(http.Handler) http.Handler
+		}
+	}{
+		{"basic", &BasicAuth{Users: map[string]string{}}},
+		{"bearer", &BearerAuth{}},
+		{"api key", &APIKeyAuth{}},
+		{"hmac", &HMACAuth{Secret: []byte{}}},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Error("expected panic")
+				}
+			}()
+			tc.auth.Handler(whoami)
+		})
+	}
+}
@@ -0,0 +1,339 @@
+package middleware
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultSkipTypes content types not compressed by Compress, already
+// compressed formats, a trailing "/" matches the whole type
+var DefaultSkipTypes = []string{
+	"image/png",
+	"image/jpeg",
+	"image/gif",
+	"image/webp",
+	"image/avif",
+	"video/",
+	"audio/",
+	"font/woff",
+	"font/woff2",
+	"application/zip",
+	"application/gzip",
+	"application/x-gzip",
+	"application/zstd",
+	"application/x-bzip2",
+	"application/x-xz",
+	"application/x-7z-compressed",
+	"application/x-rar-compressed",
+	"application/octet-stream",
+}
+
+// Compress compresses the responses using gzip or deflate depending on the
+// Accept-Encoding header, example:
+//  router.Use(middleware.NewCompress(gzip.DefaultCompression).Handler)
+// Responses smaller than MinSize, with a Content-Encoding or a skipped
+// content type are sent as is, Flush compresses and flushes the data written
+// so far, the streaming routes keep working.
+type Compress struct {
+	// Level of compression, from gzip.BestSpeed to gzip.BestCompression,
+	// 0 uses gzip.DefaultCompression
+	Level int
+
+	// MinSize responses smaller than MinSize bytes are not compressed, 1024
+	// by default
+	MinSize int
+
+	// SkipTypes content types not compressed, DefaultSkipTypes if nil
+	SkipTypes []string
+
+	gzipPool, zlibPool sync.Pool
+}
+
+// NewCompress returns Compress using the given level and the defaults
+func NewCompress(level int) *Compress {
+	return &Compress{
+		Level:     level,
+		MinSize:   1024,
+		SkipTypes: DefaultSkipTypes,
+	}
+}
+
+// Handler middleware compressing the responses
+func (c *Compress) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		addVary(w.Header(), "Accept-Encoding")
+		encoding := acceptEncoding(r.Header.Get("Accept-Encoding"))
+		if encoding == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		cw := &compressWriter{
+			ResponseWriter: w,
+			c:              c,
+			encoding:       encoding,
+			status:         http.StatusOK,
+		}
+		next.ServeHTTP(cw, r)
+		cw.close()
+	})
+}
+
+// level returns the compression level
+func (c *Compress) level() int {
+	if c.Level == 0 {
+		return gzip.DefaultCompression
+	}
+	return c.Level
+}
+
+// minSize returns the minimum size to compress
+func (c *Compress) minSize() int {
+	if c.MinSize <= 0 {
+		return 1024
+	}
+	return c.MinSize
+}
+
+// skip reports whether the content type must not be compressed
+func (c *Compress) skip(contentType string) bool {
+	types := c.SkipTypes
+	if types == nil {
+		types = DefaultSkipTypes
+	}
+	if i := strings.IndexByte(contentType, ';'); i != -1 {
+		contentType = contentType[:i]
+	}
+	contentType = strings.ToLower(strings.TrimSpace(contentType))
+	for _, t := range types {
+		if contentType == t || (strings.HasSuffix(t, "/") && strings.HasPrefix(contentType, t)) {
+			return true
+		}
+	}
+	return false
+}
+
+// encoder returns a pooled encoder writing to w
+func (c *Compress) encoder(encoding string, w io.Writer) (io.WriteCloser, error) {
+	if encoding == "gzip" {
+		if gw, ok := c.gzipPool.Get().(*gzip.Writer); ok {
+			gw.Reset(w)
+			return gw, nil
+		}
+		return gzip.NewWriterLevel(w, c.level())
+	}
+	// the deflate coding is the zlib format (RFC 1950)
+	if zw, ok := c.zlibPool.Get().(*zlib.Writer); ok {
+		zw.Reset(w)
+		return zw, nil
+	}
+	return zlib.NewWriterLevel(w, c.level())
+}
+
+// release returns the encoder to its pool
+func (c *Compress) release(enc io.WriteCloser) {
+	switch enc := enc.(type) {
+	case *gzip.Writer:
+		c.gzipPool.Put(enc)
+	case *zlib.Writer:
+		c.zlibPool.Put(enc)
+	}
+}
+
+// acceptEncoding returns the preferred encoding of the Accept-Encoding
+// header, gzip or deflate, empty if none is acceptable, "*" applies to the
+// encodings not listed
+func acceptEncoding(header string) string {
+	// -1 not listed
+	gzipQ, deflateQ, anyQ := -1.0, -1.0, -1.0
+	for _, part := range strings.Split(header, ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			var err error
+			if q, err = strconv.ParseFloat(v, 64); err != nil {
+				continue
+			}
+		}
+		switch strings.ToLower(strings.TrimSpace(coding)) {
+		case "gzip", "x-gzip":
+			gzipQ = math.Max(gzipQ, q)
+		case "deflate":
+			deflateQ = math.Max(deflateQ, q)
+		case "*":
+			anyQ = math.Max(anyQ, q)
+		}
+	}
+	if gzipQ < 0 {
+		gzipQ = anyQ
+	}
+	if deflateQ < 0 {
+		deflateQ = anyQ
+	}
+	// gzip preferred on ties
+	switch {
+	case gzipQ > 0 && gzipQ >= deflateQ:
+		return "gzip"
+	case deflateQ > 0:
+		return "deflate"
+	}
+	return ""
+}
+
+// addVary adds value to the Vary header if not present
+func addVary(h http.Header, value string) {
+	for _, v := range h.Values("Vary") {
+		for _, field := range strings.Split(v, ",") {
+			field = strings.TrimSpace(field)
+			if field == "*" || strings.EqualFold(field, value) {
+				return
+			}
+		}
+	}
+	h.Add("Vary", value)
+}
+
+// compressWriter buffers the first MinSize bytes to decide whether to
+// compress the response
+type compressWriter struct {
+	http.ResponseWriter
+	c           *Compress
+	encoding    string
+	status      int
+	wroteHeader bool
+	decided     bool
+	buf         []byte
+	enc         io.WriteCloser
+}
+
+// WriteHeader keeps the status code until the first bytes are written,
+// informational headers are written
+func (w *compressWriter) WriteHeader(statusCode int) {
+	if w.wroteHeader {
+		return
+	}
+	if statusCode >= 100 && statusCode < 200 && statusCode != http.StatusSwitchingProtocols {
+		w.ResponseWriter.WriteHeader(statusCode)
+		return
+	}
+	w.status = statusCode
+	w.wroteHeader = true
+}
+
+// Write buffers the data until MinSize bytes are written, then writes it
+// compressed or as is
+func (w *compressWriter) Write(data []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if !w.decided {
+		w.buf = append(w.buf, data...)
+		if len(w.buf) < w.c.minSize() {
+			return len(data), nil
+		}
+		if err := w.decide(true); err != nil {
+			return 0, err
+		}
+		return len(data), nil
+	}
+	if w.enc != nil {
+		return w.enc.Write(data)
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+// Flush compresses and flushes the data written so far, implements
+// http.Flusher
+func (w *compressWriter) Flush() {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if !w.decided {
+		if err := w.decide(true); err != nil {
+			return
+		}
+	}
+	if f, ok := w.enc.(interface{ Flush() error }); ok {
+		if err := f.Flush(); err != nil {
+			return
+		}
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap returns the wrapped http.ResponseWriter, used by
+// http.ResponseController to reach the optional interfaces, example:
+// http.Hijacker
+func (w *compressWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// decide writes the header compressing the response if allowed, the
+// buffered data is written
+func (w *compressWriter) decide(compress bool) error {
+	w.decided = true
+	h := w.Header()
+	if h.Get("Content-Type") == "" && len(w.buf) > 0 {
+		// sniff before compressing, otherwise net/http sniffs the
+		// compressed data
+		h.Set("Content-Type", http.DetectContentType(w.buf))
+	}
+	switch {
+	case !compress,
+		w.status < http.StatusOK,
+		w.status == http.StatusNoContent,
+		w.status == http.StatusPartialContent,
+		w.status == http.StatusNotModified,
+		h.Get("Content-Encoding") != "",
+		h.Get("Content-Range") != "",
+		w.c.skip(h.Get("Content-Type")):
+		w.ResponseWriter.WriteHeader(w.status)
+	default:
+		h.Del("Content-Length")
+		h.Set("Content-Encoding", w.encoding)
+		// the compressed representation differs byte for byte
+		if etag := h.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+			h.Set("ETag", "W/"+etag)
+		}
+		w.ResponseWriter.WriteHeader(w.status)
+		enc, err := w.c.encoder(w.encoding, w.ResponseWriter)
+		if err != nil {
+			return err
+		}
+		w.enc = enc
+	}
+	buf := w.buf
+	w.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	if w.enc != nil {
+		_, err := w.enc.Write(buf)
+		return err
+	}
+	_, err := w.ResponseWriter.Write(buf)
+	return err
+}
+
+// close writes the response if still buffered and closes the encoder
+func (w *compressWriter) close() {
+	if !w.decided {
+		if !w.wroteHeader {
+			return
+		}
+		// smaller than MinSize
+		w.decide(false)
+	}
+	if w.enc != nil {
+		w.enc.Close()
+		w.c.release(w.enc)
+		w.enc = nil
+	}
+}
@@ -0,0 +1,234 @@
+package middleware
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/nbari/violetear/v7"
+)
+
+func TestAcceptEncoding(t *testing.T) {
+	tt := []struct {
+		header, encoding string
+	}{
+		{"", ""},
+		{"gzip", "gzip"},
+		{"deflate", "deflate"},
+		{"deflate, gzip", "gzip"},
+		{"gzip;q=0.5, deflate", "deflate"},
+		{"gzip;q=0, deflate;q=0", ""},
+		{"br", ""},
+		{"br, *", "gzip"},
+		{"gzip;q=0, *", "deflate"},
+		{"gzip;q=0, deflate;q=0, *", ""},
+		{"deflate;q=0.5, *;q=0.8", "gzip"},
+		{"*;q=0", ""},
+		{"identity", ""},
+	}
+	for _, tc := range tt {
+		if e := acceptEncoding(tc.header); e != tc.encoding {
+			t.Errorf("%q: expected %q, got %q", tc.header, tc.encoding, e)
+		}
+	}
+}
+
+func TestCompress(t *testing.T) {
+	text := strings.Repeat("violetear ", 200)
+	router := violetear.New()
+	router.Verbose = false
+	router.Use(NewCompress(gzip.BestSpeed).Handler)
+	router.HandleFunc("/text", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "2000")
+		w.Header().Set("ETag", `"text"`)
+		w.Write([]byte(text[:1000]))
+		w.Write([]byte(text[1000:]))
+	}, "GET")
+	router.HandleFunc("/small", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("small"))
+	}, "GET")
+	router.HandleFunc("/image", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		w.Write([]byte(text))
+	}, "GET")
+	router.HandleFunc("/encoded", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Encoding", "br")
+		w.Write([]byte(text))
+	}, "GET")
+	router.HandleFunc("/created", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(text))
+	}, "POST")
+	router.HandleFunc("/empty", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}, "GET")
+
+	tt := []struct {
+		name     string
+		method   string
+		path     string
+		accept   string
+		code     int
+		encoding string
+		body     string
+	}{
+		{"gzip", "GET", "/text", "gzip, deflate", 200, "gzip", text},
+		{"deflate", "GET", "/text", "deflate", 200, "deflate", text},
+		{"gzip refused", "GET", "/text", "gzip;q=0, *", 200, "deflate", text},
+		{"identity", "GET", "/text", "", 200, "", text},
+		{"small", "GET", "/small", "gzip", 200, "", "small"},
+		{"image", "GET", "/image", "gzip", 200, "", text},
+		{"encoded", "GET", "/encoded", "gzip", 200, "br", text},
+		{"status", "POST", "/created", "gzip", 201, "gzip", text},
+		{"no content", "GET", "/empty", "gzip", 204, "", ""},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest(tc.method, tc.path, nil)
+			if tc.accept != "" {
+				req.Header.Set("Accept-Encoding", tc.accept)
+			}
+			router.ServeHTTP(w, req)
+			if w.Code != tc.code {
+				t.Errorf("expected status %d, got %d", tc.code, w.Code)
+			}
+			if e := w.Header().Get("Content-Encoding"); e != tc.encoding {
+				t.Errorf("expected Content-Encoding %q, got %q", tc.encoding, e)
+			}
+			if v := w.Header().Get("Vary"); v != "Accept-Encoding" {
+				t.Errorf("expected Vary Accept-Encoding, got %q", v)
+			}
+			var body io.Reader = w.Body
+			switch tc.encoding {
+			case "gzip":
+				gr, err := gzip.NewReader(w.Body)
+				if err != nil {
+					t.Fatal(err)
+				}
+				body = gr
+			case "deflate":
+				zr, err := zlib.NewReader(w.Body)
+				if err != nil {
+					t.Fatal(err)
+				}
+				body = zr
+			}
+			if tc.encoding == "gzip" || tc.encoding == "deflate" {
+				if w.Header().Get("Content-Length") != "" {
+					t.Errorf("unexpected Content-Length %q", w.Header().Get("Content-Length"))
+				}
+				if w.Body.Len() >= len(text) {
+					t.Errorf("expected compressed body, got %d bytes", w.Body.Len())
+				}
+			}
+			b, err := io.ReadAll(body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(b) != tc.body {
+				t.Errorf("expected body %q, got %q", tc.body, b)
+			}
+		})
+	}
+
+	// strong ETag becomes weak
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/text", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	router.ServeHTTP(w, req)
+	if etag := w.Header().Get("ETag"); etag != `W/"text"` {
+		t.Errorf("expected weak ETag, got %q", etag)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "text/plain; charset=utf-8" {
+		t.Errorf("expected sniffed Content-Type, got %q", ct)
+	}
+}
+
+func TestCompressFlush(t *testing.T) {
+	chunks := make(chan string)
+	router := violetear.New()
+	router.Verbose = false
+	router.Use((&Compress{}).Handler)
+	router.HandleFunc("/events", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		for chunk := range chunks {
+			w.Write([]byte(chunk))
+			w.(http.Flusher).Flush()
+		}
+	}, "GET")
+
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	go func() {
+		chunks <- "data: 1\n\n"
+	}()
+	res, err := http.Get(ts.URL + "/events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if !res.Uncompressed {
+		t.Errorf("expected compressed response, got %v", res.Header)
+	}
+	// the first event is received before the handler returns
+	b := make([]byte, 9)
+	if _, err := io.ReadFull(res.Body, b); err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "data: 1\n\n" {
+		t.Errorf("unexpected event %q", b)
+	}
+	chunks <- "data: 2\n\n"
+	close(chunks)
+	rest, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(rest) != "data: 2\n\n" {
+		t.Errorf("unexpected event %q", rest)
+	}
+}
+
+func TestCompressHijack(t *testing.T) {
+	h := (&Compress{}).Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := w.(http.Hijacker); ok {
+			t.Error("unexpected http.Hijacker")
+		}
+		conn, _, err := http.NewResponseController(w).Hijack()
+		if r.URL.Path == "/recorder" {
+			if !errors.Is(err, http.ErrNotSupported) {
+				t.Errorf("expected http.ErrNotSupported, got %v", err)
+			}
+			return
+		}
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		conn.Write([]byte("HTTP/1.1 200 OK\r\nContent-Length: 8\r\nConnection: close\r\n\r\nhijacked"))
+		conn.Close()
+	}))
+
+	req := httptest.NewRequest("GET", "/recorder", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+
+	ts := httptest.NewServer(h)
+	defer ts.Close()
+	res, err := http.Get(ts.URL + "/hijack")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	b, _ := io.ReadAll(res.Body)
+	if string(b) != "hijacked" {
+		t.Errorf("expected hijacked, got %q", b)
+	}
+}
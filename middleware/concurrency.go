@@ -0,0 +1,263 @@
+package middleware
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"math"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/nbari/violetear/v7"
+)
+
+// Concurrency limits the requests being served globally and per route,
+// the requests over the limit wait in a bounded queue and, when it is full
+// or they wait more than QueueTimeout, get a 503 Service Unavailable with
+// Retry-After, example:
+//  limiter := &middleware.Concurrency{
+//      Limit:        100,
+//      RouteLimit:   10,
+//      QueueSize:    50,
+//      QueueTimeout: time.Second,
+//  }
+//  router.Use(limiter.Handler)
+//  router.AddStats("concurrency", limiter)
+// The statistics per route pattern are reported by router.Routes.
+type Concurrency struct {
+	// Limit requests served at once by all the routes, 0 for no limit
+	Limit int
+
+	// RouteLimit requests served at once by each route, 0 for no limit
+	RouteLimit int
+
+	// QueueSize requests waiting for each limit, 0 rejects the requests
+	// over the limit
+	QueueSize int
+
+	// QueueTimeout time a request can wait, 0 waits until the request is
+	// canceled
+	QueueTimeout time.Duration
+
+	// RetryAfter time sent in the Retry-After header, one second by default
+	RetryAfter time.Duration
+
+	// TargetLatency enables the adaptive limits when greater than 0, the
+	// limits decrease while the requests take longer and increase back up
+	// to Limit and RouteLimit otherwise
+	TargetLatency time.Duration
+
+	// RejectedHandler called when the request is rejected, 503 Service
+	// Unavailable by default
+	RejectedHandler http.Handler
+
+	once   sync.Once
+	global *limiter
+	mu     sync.Mutex
+	routes map[string]*limiter
+}
+
+// ConcurrencyStats statistics of a limit
+type ConcurrencyStats struct {
+	// Limit current limit, it changes when adaptive, 0 for no limit
+	Limit int
+
+	// InFlight requests being served
+	InFlight int
+
+	// Queued requests waiting
+	Queued int
+
+	// Rejected requests since the start
+	Rejected uint64
+}
+
+// errRejected returned when the request can't be served
+var errRejected = errors.New("concurrency: rejected")
+
+// Handler middleware limiting the requests being served
+func (c *Concurrency) Handler(next http.Handler) http.Handler {
+	c.init()
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		if c.QueueTimeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, c.QueueTimeout)
+			defer cancel()
+		}
+
+		var rl *limiter
+		if info := violetear.GetRouteInfo(r); info != nil {
+			rl = c.route(info)
+			if err := rl.acquire(ctx, c.QueueSize); err != nil {
+				c.reject(w, r)
+				return
+			}
+		}
+		if err := c.global.acquire(ctx, c.QueueSize); err != nil {
+			if rl != nil {
+				rl.release(0, 0)
+			}
+			c.reject(w, r)
+			return
+		}
+
+		start := time.Now()
+		defer func() {
+			d := time.Since(start)
+			c.global.release(d, c.TargetLatency)
+			if rl != nil {
+				rl.release(d, c.TargetLatency)
+			}
+		}()
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Stats returns the statistics of the global limit
+func (c *Concurrency) Stats() ConcurrencyStats {
+	c.init()
+	return c.global.stats()
+}
+
+// RouteStats returns the statistics of the route pattern, implements
+// violetear.RouteStats
+func (c *Concurrency) RouteStats(info *violetear.RouteInfo) interface{} {
+	c.mu.Lock()
+	l, ok := c.routes[info.Host+info.Pattern]
+	c.mu.Unlock()
+	if !ok {
+		return nil
+	}
+	return l.stats()
+}
+
+// init creates the global limiter
+func (c *Concurrency) init() {
+	c.once.Do(func() {
+		c.global = newLimiter(c.Limit)
+		c.routes = map[string]*limiter{}
+	})
+}
+
+// route returns the limiter of the route pattern
+func (c *Concurrency) route(info *violetear.RouteInfo) *limiter {
+	key := info.Host + info.Pattern
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	l, ok := c.routes[key]
+	if !ok {
+		l = newLimiter(c.RouteLimit)
+		c.routes[key] = l
+	}
+	return l
+}
+
+// reject responds with the RejectedHandler
+func (c *Concurrency) reject(w http.ResponseWriter, r *http.Request) {
+	retry := c.RetryAfter
+	if retry <= 0 {
+		retry = time.Second
+	}
+	w.Header().Set("Retry-After", seconds(retry))
+	if c.RejectedHandler != nil {
+		c.RejectedHandler.ServeHTTP(w, r)
+		return
+	}
+	http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+}
+
+// limiter semaphore with a queue of waiting requests
+type limiter struct {
+	mu       sync.Mutex
+	max      int
+	limit    float64
+	inFlight int
+	queue    *list.List
+	rejected uint64
+}
+
+// newLimiter returns a limiter allowing max requests, 0 for no limit
+func newLimiter(max int) *limiter {
+	return &limiter{max: max, limit: float64(max), queue: list.New()}
+}
+
+// acquire waits until the request can be served, errRejected if the queue
+// is full or ctx is done while waiting
+func (l *limiter) acquire(ctx context.Context, queueSize int) error {
+	l.mu.Lock()
+	if l.max <= 0 || (l.inFlight < int(l.limit) && l.queue.Len() == 0) {
+		l.inFlight++
+		l.mu.Unlock()
+		return nil
+	}
+	if l.queue.Len() >= queueSize {
+		l.rejected++
+		l.mu.Unlock()
+		return errRejected
+	}
+	ready := make(chan struct{})
+	e := l.queue.PushBack(ready)
+	l.mu.Unlock()
+
+	select {
+	case <-ready:
+		return nil
+	case <-ctx.Done():
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		select {
+		case <-ready:
+			// acquired while giving up
+			l.inFlight--
+			l.grant()
+		default:
+			l.queue.Remove(e)
+		}
+		l.rejected++
+		return errRejected
+	}
+}
+
+// release frees the slot of a request that took d, adapting the limit to
+// the target latency if greater than 0
+func (l *limiter) release(d, target time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.inFlight--
+	if target > 0 && l.max > 0 && d > 0 {
+		if d > target {
+			// multiplicative decrease
+			l.limit = math.Max(1, l.limit*0.9)
+		} else {
+			// additive increase
+			l.limit = math.Min(float64(l.max), l.limit+1/l.limit)
+		}
+	}
+	l.grant()
+}
+
+// grant lets the queued requests in while below the limit
+func (l *limiter) grant() {
+	for l.queue.Len() > 0 && l.inFlight < int(l.limit) {
+		ready := l.queue.Remove(l.queue.Front()).(chan struct{})
+		l.inFlight++
+		close(ready)
+	}
+}
+
+// stats returns the statistics of the limiter
+func (l *limiter) stats() ConcurrencyStats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	s := ConcurrencyStats{
+		InFlight: l.inFlight,
+		Queued:   l.queue.Len(),
+		Rejected: l.rejected,
+	}
+	if l.max > 0 {
+		s.Limit = int(l.limit)
+	}
+	return s
+}
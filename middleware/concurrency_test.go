@@ -0,0 +1,144 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/nbari/violetear/v7"
+)
+
+// routeStats returns the concurrency stats of the route pattern
+func routeStats(router *violetear.Router, pattern string) ConcurrencyStats {
+	for _, route := range router.Routes() {
+		if route.Pattern == pattern {
+			s, _ := route.Stats["concurrency"].(ConcurrencyStats)
+			return s
+		}
+	}
+	return ConcurrencyStats{}
+}
+
+func TestConcurrency(t *testing.T) {
+	limiter := &Concurrency{Limit: 10, RouteLimit: 1, QueueSize: 1}
+	router := violetear.New()
+	router.Verbose = false
+	router.Use(limiter.Handler)
+	router.AddStats("concurrency", limiter)
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	router.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		<-release
+	}, "GET")
+	router.HandleFunc("/fast", func(w http.ResponseWriter, r *http.Request) {}, "GET")
+
+	codes := make(chan int, 2)
+	get := func(path string) int {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", path, nil)
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+	go func() { codes <- get("/slow") }()
+	<-started
+	go func() { codes <- get("/slow") }()
+	for routeStats(router, "/slow").Queued != 1 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// the queue is full
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/slow", nil)
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected 503, got %d", w.Code)
+	}
+	if w.Header().Get("Retry-After") != "1" {
+		t.Errorf("expected Retry-After 1, got %q", w.Header().Get("Retry-After"))
+	}
+
+	// other routes are not affected
+	if code := get("/fast"); code != http.StatusOK {
+		t.Errorf("expected 200, got %d", code)
+	}
+
+	s := routeStats(router, "/slow")
+	if s != (ConcurrencyStats{Limit: 1, InFlight: 1, Queued: 1, Rejected: 1}) {
+		t.Errorf("unexpected stats %+v", s)
+	}
+	if s := limiter.Stats(); s.InFlight != 1 || s.Limit != 10 {
+		t.Errorf("unexpected global stats %+v", s)
+	}
+	if s := routeStats(router, "/fast"); s != (ConcurrencyStats{Limit: 1}) {
+		t.Errorf("unexpected stats %+v", s)
+	}
+
+	release <- struct{}{}
+	<-started
+	release <- struct{}{}
+	for i := 0; i < 2; i++ {
+		if code := <-codes; code != http.StatusOK {
+			t.Errorf("expected 200, got %d", code)
+		}
+	}
+	if s := routeStats(router, "/slow"); s.InFlight != 0 || s.Queued != 0 {
+		t.Errorf("unexpected stats %+v", s)
+	}
+}
+
+func TestConcurrencyQueueTimeout(t *testing.T) {
+	limiter := &Concurrency{
+		Limit:           1,
+		QueueSize:       10,
+		QueueTimeout:    10 * time.Millisecond,
+		RetryAfter:      5 * time.Second,
+		RejectedHandler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusTooManyRequests) }),
+	}
+	started := make(chan struct{})
+	release := make(chan struct{})
+	h := limiter.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+	}))
+	done := make(chan struct{})
+	go func() {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+		close(done)
+	}()
+	<-started
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if w.Code != http.StatusTooManyRequests {
+		t.Errorf("expected 429, got %d", w.Code)
+	}
+	if w.Header().Get("Retry-After") != "5" {
+		t.Errorf("expected Retry-After 5, got %q", w.Header().Get("Retry-After"))
+	}
+	if s := limiter.Stats(); s != (ConcurrencyStats{Limit: 1, InFlight: 1, Rejected: 1}) {
+		t.Errorf("unexpected stats %+v", s)
+	}
+	close(release)
+	<-done
+}
+
+func TestLimiterAdaptive(t *testing.T) {
+	l := newLimiter(10)
+	for i := 0; i < 5; i++ {
+		l.inFlight++
+		l.release(time.Second, 100*time.Millisecond)
+	}
+	if s := l.stats(); s.Limit != 5 {
+		t.Errorf("expected limit 5, got %d", s.Limit)
+	}
+	for i := 0; i < 100; i++ {
+		l.inFlight++
+		l.release(time.Millisecond, 100*time.Millisecond)
+	}
+	if s := l.stats(); s.Limit != 10 {
+		t.Errorf("expected limit 10, got %d", s.Limit)
+	}
+}
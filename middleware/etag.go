@@ -0,0 +1,153 @@
+package middleware
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/nbari/violetear/v7"
+)
+
+// ETag computes the ETag of the GET and HEAD responses and answers the
+// conditional requests (If-None-Match and If-Modified-Since) with 304 Not
+// Modified, PUT, PATCH and DELETE requests with an If-Match or
+// If-Unmodified-Since precondition that fails are answered with 412
+// Precondition Failed, example:
+//  etag := &middleware.ETag{Weak: true}
+//  router.HandleFunc("/item/:id", handleItem, "GET,HEAD,PUT").Use(etag.Handler)
+// An ETag or Last-Modified header set by the handler is used as is. The
+// ETag of HEAD requests is only computed if the handler writes the body, as
+// for GET, otherwise it would be the one of an empty body.
+type ETag struct {
+	// Weak computes weak ETags (W/"..."), for responses that are
+	// semantically equivalent but not byte for byte identical
+	Weak bool
+
+	// MaxSize responses bigger than MaxSize bytes are streamed without an
+	// ETag, 1MB by default
+	MaxSize int
+
+	// Current returns the ETag and last modification time of the resource,
+	// used to check the preconditions of PUT, PATCH and DELETE, if nil the
+	// preconditions are left to the handler
+	Current func(r *http.Request) (etag string, modified time.Time)
+}
+
+// Handler middleware computing the ETag and checking the preconditions
+func (e *ETag) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead:
+		case http.MethodPut, http.MethodPatch, http.MethodDelete:
+			if e.Current != nil && !e.preconditions(r) {
+				http.Error(w, http.StatusText(http.StatusPreconditionFailed), http.StatusPreconditionFailed)
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		default:
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		maxSize := e.MaxSize
+		if maxSize <= 0 {
+			maxSize = 1 << 20
+		}
+		bw := violetear.NewBufferedWriter(w, maxSize)
+		next.ServeHTTP(bw, r)
+		if !bw.Buffered() || bw.Status() != http.StatusOK {
+			bw.Send()
+			return
+		}
+
+		h := bw.Header()
+		etag := h.Get("ETag")
+		if etag == "" && r.Method == http.MethodHead && len(bw.Body()) == 0 {
+			// the handler skipped the body, the ETag would differ from GET
+			bw.Send()
+			return
+		}
+		if etag == "" {
+			sum := sha256.Sum256(bw.Body())
+			etag = `"` + hex.EncodeToString(sum[:16]) + `"`
+			if e.Weak {
+				etag = "W/" + etag
+			}
+			h.Set("ETag", etag)
+		}
+		if notModified(r, etag, h.Get("Last-Modified")) {
+			h.Del("Content-Type")
+			h.Del("Content-Length")
+			bw.SetStatus(http.StatusNotModified)
+			bw.SetBody(nil)
+		}
+		bw.Send()
+	})
+}
+
+// preconditions reports whether the If-Match or If-Unmodified-Since
+// preconditions of the request are satisfied
+func (e *ETag) preconditions(r *http.Request) bool {
+	ifMatch := r.Header.Get("If-Match")
+	ifUnmodified := r.Header.Get("If-Unmodified-Since")
+	if ifMatch == "" && ifUnmodified == "" {
+		return true
+	}
+	etag, modified := e.Current(r)
+	if ifMatch != "" {
+		// strong comparison, "*" matches any existing resource
+		if etag == "" {
+			return false
+		}
+		return matchETag(ifMatch, etag, false)
+	}
+	since, err := http.ParseTime(ifUnmodified)
+	if err != nil || modified.IsZero() {
+		return true
+	}
+	return !modified.Truncate(time.Second).After(since)
+}
+
+// notModified reports whether the response can be answered with 304, If-None-Match
+// takes precedence over If-Modified-Since
+func notModified(r *http.Request, etag, lastModified string) bool {
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		return matchETag(inm, etag, true)
+	}
+	ims := r.Header.Get("If-Modified-Since")
+	if ims == "" || lastModified == "" {
+		return false
+	}
+	since, err := http.ParseTime(ims)
+	if err != nil {
+		return false
+	}
+	modified, err := http.ParseTime(lastModified)
+	if err != nil {
+		return false
+	}
+	return !modified.After(since)
+}
+
+// matchETag reports whether etag is in the comma separated list, weak
+// comparison ignores the W/ prefix, strong comparison doesn't match weak
+// ETags
+func matchETag(list, etag string, weak bool) bool {
+	for _, candidate := range strings.Split(list, ",") {
+		candidate = strings.TrimSpace(candidate)
+		switch {
+		case candidate == "*":
+			return true
+		case weak:
+			if strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+				return true
+			}
+		case candidate == etag && !strings.HasPrefix(etag, "W/"):
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,146 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/nbari/violetear/v7"
+)
+
+func TestETag(t *testing.T) {
+	modified := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	current := `"v1"`
+	etag := &ETag{
+		Current: func(r *http.Request) (string, time.Time) {
+			return current, modified
+		},
+	}
+	router := violetear.New()
+	router.Verbose = false
+	router.HandleFunc("/item", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte("item"))
+	}, "GET,HEAD").Use(etag.Handler)
+	router.HandleFunc("/item", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}, "PUT,DELETE").Use(etag.Handler)
+	router.HandleFunc("/dated", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Last-Modified", modified.Format(http.TimeFormat))
+		w.Header().Set("ETag", `W/"dated"`)
+		w.Write([]byte("dated"))
+	}, "GET").Use((&ETag{Weak: true}).Handler)
+	router.HandleFunc("/error", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "error", http.StatusInternalServerError)
+	}, "GET").Use(etag.Handler)
+	router.HandleFunc("/nobody", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodHead {
+			return
+		}
+		w.Write([]byte("nobody"))
+	}, "GET,HEAD").Use(etag.Handler)
+	router.HandleFunc("/big", func(w http.ResponseWriter, r *http.Request) {
+		w.Write(make([]byte, 20))
+	}, "GET").Use((&ETag{MaxSize: 10}).Handler)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/item", nil)
+	router.ServeHTTP(w, req)
+	itemETag := w.Header().Get("ETag")
+	if len(itemETag) != 34 || itemETag[0] != '"' {
+		t.Fatalf("unexpected ETag %q", itemETag)
+	}
+
+	// HEAD gets the same ETag as GET
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("HEAD", "/item", nil)
+	router.ServeHTTP(w, req)
+	if e := w.Header().Get("ETag"); e != itemETag {
+		t.Errorf("expected HEAD ETag %q, got %q", itemETag, e)
+	}
+	// no ETag if the body is skipped
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("HEAD", "/nobody", nil)
+	router.ServeHTTP(w, req)
+	if e := w.Header().Get("ETag"); e != "" {
+		t.Errorf("unexpected HEAD ETag %q", e)
+	}
+
+	tt := []struct {
+		name   string
+		method string
+		path   string
+		header map[string]string
+		code   int
+		body   string
+	}{
+		{"get", "GET", "/item", nil, 200, "item"},
+		{"head", "HEAD", "/item", nil, 200, "item"},
+		{"head if-none-match", "HEAD", "/item", map[string]string{"If-None-Match": itemETag}, 304, ""},
+		{"head no body", "HEAD", "/nobody", map[string]string{"If-None-Match": "*"}, 200, ""},
+		{"if-none-match", "GET", "/item", map[string]string{"If-None-Match": `"other", ` + itemETag}, 304, ""},
+		{"if-none-match weak", "GET", "/item", map[string]string{"If-None-Match": "W/" + itemETag}, 304, ""},
+		{"if-none-match *", "GET", "/item", map[string]string{"If-None-Match": "*"}, 304, ""},
+		{"if-none-match changed", "GET", "/item", map[string]string{"If-None-Match": `"other"`}, 200, "item"},
+		{"if-modified-since", "GET", "/dated", map[string]string{"If-Modified-Since": modified.Format(http.TimeFormat)}, 304, ""},
+		{"if-modified-since older", "GET", "/dated", map[string]string{"If-Modified-Since": modified.Add(-time.Hour).Format(http.TimeFormat)}, 200, "dated"},
+		{"if-none-match precedence", "GET", "/dated", map[string]string{"If-None-Match": `"other"`, "If-Modified-Since": modified.Format(http.TimeFormat)}, 200, "dated"},
+		{"error", "GET", "/error", map[string]string{"If-None-Match": "*"}, 500, "error\n"},
+		{"big", "GET", "/big", map[string]string{"If-None-Match": "*"}, 200, string(make([]byte, 20))},
+		{"put", "PUT", "/item", nil, 204, ""},
+		{"put if-match", "PUT", "/item", map[string]string{"If-Match": `"v1"`}, 204, ""},
+		{"put if-match *", "PUT", "/item", map[string]string{"If-Match": "*"}, 204, ""},
+		{"put if-match failed", "PUT", "/item", map[string]string{"If-Match": `"v0"`}, 412, "Precondition Failed\n"},
+		{"delete if-match weak", "DELETE", "/item", map[string]string{"If-Match": `W/"v1"`}, 412, "Precondition Failed\n"},
+		{"put if-unmodified-since", "PUT", "/item", map[string]string{"If-Unmodified-Since": modified.Format(http.TimeFormat)}, 204, ""},
+		{"put if-unmodified-since failed", "PUT", "/item", map[string]string{"If-Unmodified-Since": modified.Add(-time.Hour).Format(http.TimeFormat)}, 412, "Precondition Failed\n"},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest(tc.method, tc.path, nil)
+			for k, v := range tc.header {
+				req.Header.Set(k, v)
+			}
+			router.ServeHTTP(w, req)
+			if w.Code != tc.code {
+				t.Errorf("expected status %d, got %d", tc.code, w.Code)
+			}
+			if w.Body.String() != tc.body {
+				t.Errorf("expected body %q, got %q", tc.body, w.Body.String())
+			}
+			if w.Code == 304 {
+				if w.Header().Get("ETag") == "" || w.Header().Get("Content-Type") != "" {
+					t.Errorf("unexpected 304 headers %v", w.Header())
+				}
+			}
+		})
+	}
+
+	// no resource
+	current = ""
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("PUT", "/item", nil)
+	req.Header.Set("If-Match", "*")
+	router.ServeHTTP(w, req)
+	if w.Code != 412 {
+		t.Errorf("expected status 412, got %d", w.Code)
+	}
+}
+
+func TestETagWeak(t *testing.T) {
+	h := (&ETag{Weak: true}).Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("weak"))
+	}))
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/", nil)
+	h.ServeHTTP(w, req)
+	etag := w.Header().Get("ETag")
+	if len(etag) != 36 || etag[:3] != `W/"` {
+		t.Errorf("unexpected weak ETag %q", etag)
+	}
+	if w.Header().Get("Content-Length") != "4" {
+		t.Errorf("unexpected Content-Length %q", w.Header().Get("Content-Length"))
+	}
+}
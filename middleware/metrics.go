@@ -0,0 +1,230 @@
+package middleware
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/nbari/violetear/v7"
+)
+
+// DefaultBuckets upper bounds in seconds of the latency histogram
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// DefaultSizeBuckets upper bounds in bytes of the response size histogram
+var DefaultSizeBuckets = []float64{100, 1000, 10000, 100000, 1000000, 10000000}
+
+// Metrics collects the request count, latency, in-flight requests and
+// response size labeled by route pattern, method and status, exposed in the
+// Prometheus text format by ServeHTTP, example:
+//  metrics := middleware.NewMetrics("myapp")
+//  router.Use(metrics.Handler)
+//  router.Handle("/metrics", metrics, "GET")
+// The route label is the pattern returned by violetear.GetRoutePattern, empty
+// when no route was matched, therefore the middleware must be added to the
+// router or to the routes, not wrapping the router. The methods not defined
+// by RFC 9110 or RFC 5789 (PATCH) are labeled OTHER.
+type Metrics struct {
+	// Namespace prefix of the metric names, example: myapp_requests_total
+	Namespace string
+
+	// Buckets of the latency histogram in seconds
+	Buckets []float64
+
+	// SizeBuckets of the response size histogram in bytes
+	SizeBuckets []float64
+
+	mu       sync.Mutex
+	series   map[series]*requestStats
+	inFlight map[series]int64
+}
+
+// series labels of a metric
+type series struct {
+	route, method, status string
+}
+
+// requestStats metrics of a series
+type requestStats struct {
+	count    uint64
+	duration *histogram
+	size     *histogram
+}
+
+// histogram cumulative counts of observations per bucket
+type histogram struct {
+	buckets []float64
+	counts  []uint64
+	sum     float64
+	count   uint64
+}
+
+// NewMetrics returns Metrics using the default buckets, the namespace
+// defaults to "http"
+func NewMetrics(namespace string) *Metrics {
+	if namespace == "" {
+		namespace = "http"
+	}
+	return &Metrics{
+		Namespace:   namespace,
+		Buckets:     DefaultBuckets,
+		SizeBuckets: DefaultSizeBuckets,
+		series:      map[series]*requestStats{},
+		inFlight:    map[series]int64{},
+	}
+}
+
+// Handler middleware recording the metrics of the requests
+func (m *Metrics) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := violetear.GetRoutePattern(r)
+		method := methodLabel(r.Method)
+		flight := series{route: route, method: method}
+		m.mu.Lock()
+		m.inFlight[flight]++
+		m.mu.Unlock()
+
+		hw, ww := violetear.WrapResponseWriter(w, "")
+		defer func() {
+			elapsed := ww.Duration().Seconds()
+			m.mu.Lock()
+			defer m.mu.Unlock()
+			m.inFlight[flight]--
+			s := series{route, method, strconv.Itoa(ww.Status())}
+			stats, ok := m.series[s]
+			if !ok {
+				stats = &requestStats{
+					duration: newHistogram(m.Buckets),
+					size:     newHistogram(m.SizeBuckets),
+				}
+				m.series[s] = stats
+			}
+			stats.count++
+			stats.duration.observe(elapsed)
+			stats.size.observe(float64(ww.Size()))
+		}()
+		next.ServeHTTP(hw, r)
+	})
+}
+
+// methodLabel returns the method, OTHER if it is not a standard one, the
+// clients can send any method
+func methodLabel(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut,
+		http.MethodPatch, http.MethodDelete, http.MethodConnect,
+		http.MethodOptions, http.MethodTrace:
+		return method
+	}
+	return "OTHER"
+}
+
+// ServeHTTP writes the metrics using the Prometheus text exposition format
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	bw := bufio.NewWriter(w)
+	m.write(bw)
+	bw.Flush()
+}
+
+// write writes the metrics sorted by labels
+func (m *Metrics) write(w io.Writer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	keys := make([]series, 0, len(m.series))
+	for s := range m.series {
+		keys = append(keys, s)
+	}
+	sortSeries(keys)
+
+	name := m.Namespace + "_requests_total"
+	fmt.Fprintf(w, "# HELP %s Total number of HTTP requests.\n# TYPE %s counter\n", name, name)
+	for _, s := range keys {
+		fmt.Fprintf(w, "%s%s %d\n", name, s.labels(""), m.series[s].count)
+	}
+
+	name = m.Namespace + "_request_duration_seconds"
+	fmt.Fprintf(w, "# HELP %s HTTP request latency in seconds.\n# TYPE %s histogram\n", name, name)
+	for _, s := range keys {
+		m.series[s].duration.write(w, name, s)
+	}
+
+	name = m.Namespace + "_response_size_bytes"
+	fmt.Fprintf(w, "# HELP %s HTTP response size in bytes.\n# TYPE %s histogram\n", name, name)
+	for _, s := range keys {
+		m.series[s].size.write(w, name, s)
+	}
+
+	flights := make([]series, 0, len(m.inFlight))
+	for s := range m.inFlight {
+		flights = append(flights, s)
+	}
+	sortSeries(flights)
+	name = m.Namespace + "_requests_in_flight"
+	fmt.Fprintf(w, "# HELP %s Number of HTTP requests being served.\n# TYPE %s gauge\n", name, name)
+	for _, s := range flights {
+		fmt.Fprintf(w, "%s{route=%s,method=%s} %d\n", name, quote(s.route), quote(s.method), m.inFlight[s])
+	}
+}
+
+// labels returns the series labels, le is added when not empty
+func (s series) labels(le string) string {
+	l := fmt.Sprintf("{route=%s,method=%s,status=%s", quote(s.route), quote(s.method), quote(s.status))
+	if le != "" {
+		l += ",le=" + quote(le)
+	}
+	return l + "}"
+}
+
+// sortSeries sorts by route, method and status
+func sortSeries(s []series) {
+	sort.Slice(s, func(i, j int) bool {
+		if s[i].route != s[j].route {
+			return s[i].route < s[j].route
+		}
+		if s[i].method != s[j].method {
+			return s[i].method < s[j].method
+		}
+		return s[i].status < s[j].status
+	})
+}
+
+// quote escapes a label value
+func quote(v string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(v) + `"`
+}
+
+// newHistogram returns an empty histogram
+func newHistogram(buckets []float64) *histogram {
+	return &histogram{
+		buckets: buckets,
+		counts:  make([]uint64, len(buckets)),
+	}
+}
+
+// observe adds a value to the histogram
+func (h *histogram) observe(v float64) {
+	for i, le := range h.buckets {
+		if v <= le {
+			h.counts[i]++
+		}
+	}
+	h.sum += v
+	h.count++
+}
+
+// write writes the buckets, sum and count of the histogram
+func (h *histogram) write(w io.Writer, name string, s series) {
+	for i, le := range h.buckets {
+		fmt.Fprintf(w, "%s_bucket%s %d\n", name, s.labels(strconv.FormatFloat(le, 'g', -1, 64)), h.counts[i])
+	}
+	fmt.Fprintf(w, "%s_bucket%s %d\n", name, s.labels("+Inf"), h.count)
+	fmt.Fprintf(w, "%s_sum%s %s\n", name, s.labels(""), strconv.FormatFloat(h.sum, 'g', -1, 64))
+	fmt.Fprintf(w, "%s_count%s %d\n", name, s.labels(""), h.count)
+}
@@ -0,0 +1,99 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/nbari/violetear/v7"
+)
+
+func TestMetrics(t *testing.T) {
+	metrics := NewMetrics("test")
+	metrics.Buckets = []float64{1}
+	metrics.SizeBuckets = []float64{2}
+
+	router := violetear.New()
+	router.Verbose = false
+	router.AddRegex(":id", `^\d+$`)
+	router.Use(metrics.Handler)
+	router.HandleFunc("/item/:id", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("item"))
+	}, "GET")
+	router.HandleFunc("/new", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+	}, "POST")
+	router.HandleFunc("/any", func(w http.ResponseWriter, r *http.Request) {})
+
+	for _, req := range []struct {
+		method, path string
+	}{
+		{"GET", "/item/1"},
+		{"GET", "/item/2"},
+		{"POST", "/new"},
+		{"GET", "/none"},
+		{"FOO", "/any"},
+		{"BAR", "/any"},
+		{"get", "/any"},
+	} {
+		r, _ := http.NewRequest(req.method, req.path, nil)
+		router.ServeHTTP(httptest.NewRecorder(), r)
+	}
+
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("GET", "/metrics", nil)
+	metrics.ServeHTTP(w, r)
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("unexpected content type %q", ct)
+	}
+	body := w.Body.String()
+
+	for _, line := range []string{
+		"# TYPE test_requests_total counter",
+		`test_requests_total{route="/item/:id",method="GET",status="200"} 2`,
+		`test_requests_total{route="/new",method="POST",status="201"} 1`,
+		`test_requests_total{route="",method="GET",status="404"} 1`,
+		`test_requests_total{route="/any",method="OTHER",status="200"} 3`,
+		"# TYPE test_request_duration_seconds histogram",
+		`test_request_duration_seconds_bucket{route="/item/:id",method="GET",status="200",le="1"} 2`,
+		`test_request_duration_seconds_bucket{route="/item/:id",method="GET",status="200",le="+Inf"} 2`,
+		`test_request_duration_seconds_count{route="/item/:id",method="GET",status="200"} 2`,
+		"# TYPE test_response_size_bytes histogram",
+		`test_response_size_bytes_bucket{route="/item/:id",method="GET",status="200",le="2"} 0`,
+		`test_response_size_bytes_bucket{route="/new",method="POST",status="201",le="2"} 1`,
+		`test_response_size_bytes_sum{route="/item/:id",method="GET",status="200"} 8`,
+		"# TYPE test_requests_in_flight gauge",
+		`test_requests_in_flight{route="/item/:id",method="GET"} 0`,
+	} {
+		if !strings.Contains(body, line+"\n") {
+			t.Errorf("missing %q in:\n%s", line, body)
+		}
+	}
+	for _, method := range []string{"FOO", "BAR", "get"} {
+		if strings.Contains(body, `method="`+method+`"`) {
+			t.Errorf("unexpected method %q in:\n%s", method, body)
+		}
+	}
+}
+
+func TestMetricsInFlight(t *testing.T) {
+	metrics := NewMetrics("")
+	var body string
+	h := metrics.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec := httptest.NewRecorder()
+		metrics.ServeHTTP(rec, r)
+		body = rec.Body.String()
+	}))
+	r, _ := http.NewRequest("GET", "/", nil)
+	h.ServeHTTP(httptest.NewRecorder(), r)
+	if !strings.Contains(body, `http_requests_in_flight{route="",method="GET"} 1`) {
+		t.Errorf("expecting 1 request in flight:\n%s", body)
+	}
+}
+
+func TestMetricsQuote(t *testing.T) {
+	if q := quote("a\"b\\c\nd"); q != `"a\"b\\c\nd"` {
+		t.Errorf("unexpected quote %s", q)
+	}
+}
@@ -40,10 +40,16 @@
 //
 package middleware
 
-import "net/http"
+import (
+	"net/http"
 
-// Constructor pattern for all middleware
-type Constructor func(http.Handler) http.Handler
+	"github.com/nbari/violetear/v7"
+)
+
+// Constructor pattern for all middleware, it is the same type used by
+// Router.Use and Route.Use so a []Constructor can be passed to them:
+//  router.Use(constructors...)
+type Constructor = violetear.Middleware
 
 // Chain acts as a list of http.Handler constructors.
 type Chain struct {
@@ -6,6 +6,8 @@ import (
 	"net/http/httptest"
 	"reflect"
 	"testing"
+
+	"github.com/nbari/violetear/v7"
 )
 
 // A constructor for middleware
@@ -176,3 +178,23 @@ func TestExtendRespectsImmutability(t *testing.T) {
 		t.Error("Extend does not respect immutability")
 	}
 }
+
+func TestRouterUse(t *testing.T) {
+	router := violetear.New()
+	router.Verbose = false
+	constructors := []Constructor{tagMiddleware("t1\n"), tagMiddleware("t2\n")}
+	router.Use(constructors...)
+	router.Handle("/", testApp).Use(New(tagMiddleware("t3\n")).Then)
+
+	w := httptest.NewRecorder()
+	r, err := http.NewRequest("GET", "/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	router.ServeHTTP(w, r)
+
+	if w.Body.String() != "t1\nt2\nt3\napp\n" {
+		t.Error("Router.Use does not accept constructors")
+	}
+}
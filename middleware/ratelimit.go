@@ -0,0 +1,341 @@
+package middleware
+
+import (
+	"container/list"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/nbari/violetear/v7"
+)
+
+// Algorithm used by RateLimit
+type Algorithm int
+
+// Rate limit algorithms
+const (
+	// TokenBucket allows bursts of Burst requests refilled at Limit per
+	// Window
+	TokenBucket Algorithm = iota
+	// SlidingWindow allows Limit requests in any Window, approximated using
+	// the counts of the current and previous windows
+	SlidingWindow
+)
+
+// RateLimitState the state of a key kept by a RateLimitStore
+type RateLimitState struct {
+	// Tokens available, TokenBucket
+	Tokens float64
+
+	// Last time the tokens were refilled, TokenBucket
+	Last time.Time
+
+	// Count of requests in the window starting at Start and Prev in the
+	// previous one, SlidingWindow
+	Count, Prev int
+	Start       time.Time
+}
+
+// RateLimitStore keeps the state of the rate limited keys, it must be safe
+// for concurrent use
+type RateLimitStore interface {
+	// Update calls fn with the state of key, a zero state if the key is
+	// unknown or expired, the changes are kept for ttl, the calls for the
+	// same key must not overlap
+	Update(key string, ttl time.Duration, fn func(*RateLimitState)) error
+}
+
+// MemoryStore in memory RateLimitStore, the expired keys and, when MaxKeys
+// is exceeded, the least recently used ones are evicted
+type MemoryStore struct {
+	// MaxKeys keys kept, 0 for no limit
+	MaxKeys int
+
+	mu    sync.Mutex
+	keys  map[string]*list.Element
+	order *list.List
+	now   func() time.Time
+}
+
+// memoryEntry state of a key in the MemoryStore
+type memoryEntry struct {
+	key     string
+	state   RateLimitState
+	expires time.Time
+}
+
+// NewMemoryStore returns a MemoryStore keeping up to maxKeys keys, 0 for no
+// limit
+func NewMemoryStore(maxKeys int) *MemoryStore {
+	return &MemoryStore{
+		MaxKeys: maxKeys,
+		keys:    map[string]*list.Element{},
+		order:   list.New(),
+		now:     time.Now,
+	}
+}
+
+// Update calls fn with the state of key
+func (s *MemoryStore) Update(key string, ttl time.Duration, fn func(*RateLimitState)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	e, ok := s.keys[key]
+	if ok && now.After(e.Value.(*memoryEntry).expires) {
+		s.order.Remove(e)
+		delete(s.keys, key)
+		ok = false
+	}
+	if !ok {
+		e = s.order.PushFront(&memoryEntry{key: key})
+		s.keys[key] = e
+	} else {
+		s.order.MoveToFront(e)
+	}
+	entry := e.Value.(*memoryEntry)
+	fn(&entry.state)
+	entry.expires = now.Add(ttl)
+
+	// the least recently used keys are at the back
+	for back := s.order.Back(); back != nil && back != e; back = s.order.Back() {
+		old := back.Value.(*memoryEntry)
+		if !now.After(old.expires) && (s.MaxKeys <= 0 || s.order.Len() <= s.MaxKeys) {
+			break
+		}
+		s.order.Remove(back)
+		delete(s.keys, old.key)
+	}
+	return nil
+}
+
+// Len returns the number of keys kept
+func (s *MemoryStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.order.Len()
+}
+
+// RateLimit limits the requests per client and route, responding with 429
+// Too Many Requests when exceeded, example:
+//  limit := &middleware.RateLimit{Limit: 100, Window: time.Minute}
+//  router.Use(limit.Handler)
+//  login := &middleware.RateLimit{
+//      Limit:     5,
+//      Window:    time.Minute,
+//      Algorithm: middleware.SlidingWindow,
+//      Key:       middleware.KeyByParam("user"),
+//  }
+//  router.HandleFunc("/login/:user", handleLogin, "POST").Use(login.Handler)
+// Every route (by name or pattern) has its own quota, the RateLimit-Limit,
+// RateLimit-Remaining, RateLimit-Reset and RateLimit-Policy headers are
+// added to the responses and Retry-After when the limit is exceeded. If the
+// Store returns an error the request is served.
+type RateLimit struct {
+	// Limit requests allowed per Window, 0 disables the limit
+	Limit int
+
+	// Window of time, one second by default
+	Window time.Duration
+
+	// Burst requests allowed at once by the TokenBucket, Limit by default
+	Burst int
+
+	// Algorithm TokenBucket by default
+	Algorithm Algorithm
+
+	// Key returns the client of the request, KeyByIP by default
+	Key func(*http.Request) string
+
+	// Routes names of the routes limited, all the routes if empty
+	Routes []string
+
+	// Store keeps the state of the clients, a MemoryStore keeping up to
+	// 100000 keys by default
+	Store RateLimitStore
+
+	// ExceededHandler called when the limit is exceeded, 429 Too Many
+	// Requests by default
+	ExceededHandler http.Handler
+
+	once sync.Once
+	now  func() time.Time
+}
+
+// rateLimitResult outcome of taking a request from the quota
+type rateLimitResult struct {
+	allowed    bool
+	remaining  int
+	reset      time.Duration
+	retryAfter time.Duration
+}
+
+// KeyByIP returns the remote IP of the request
+func KeyByIP(r *http.Request) string {
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
+
+// KeyByHeader returns a RateLimit.Key using the value of the header, the
+// requests without it share the same quota
+func KeyByHeader(name string) func(*http.Request) string {
+	return func(r *http.Request) string {
+		return r.Header.Get(name)
+	}
+}
+
+// KeyByParam returns a RateLimit.Key using the value of the path param,
+// example: KeyByParam("user") for the route /login/:user
+func KeyByParam(name string) func(*http.Request) string {
+	return func(r *http.Request) string {
+		return violetear.GetParam(name, r)
+	}
+}
+
+// Handler middleware limiting the requests
+func (l *RateLimit) Handler(next http.Handler) http.Handler {
+	l.once.Do(func() {
+		if l.Store == nil {
+			l.Store = NewMemoryStore(100000)
+		}
+		if l.now == nil {
+			l.now = time.Now
+		}
+	})
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := l.route(r)
+		if l.Limit <= 0 || (route == "" && len(l.Routes) > 0) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		key := KeyByIP
+		if l.Key != nil {
+			key = l.Key
+		}
+		res, err := l.take(route + " " + key(r))
+		if err != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		h := w.Header()
+		h.Set("RateLimit-Limit", strconv.Itoa(l.Limit))
+		h.Set("RateLimit-Remaining", strconv.Itoa(res.remaining))
+		h.Set("RateLimit-Reset", seconds(res.reset))
+		h.Set("RateLimit-Policy", strconv.Itoa(l.Limit)+";w="+seconds(l.window()))
+		if !res.allowed {
+			h.Set("Retry-After", seconds(res.retryAfter))
+			if l.ExceededHandler != nil {
+				l.ExceededHandler.ServeHTTP(w, r)
+				return
+			}
+			http.Error(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// route returns the name or pattern of the route, empty if the route is
+// not limited
+func (l *RateLimit) route(r *http.Request) string {
+	info := violetear.GetRouteInfo(r)
+	if len(l.Routes) == 0 {
+		if info == nil {
+			return ""
+		}
+		if info.Name != "" {
+			return info.Name
+		}
+		return info.Pattern
+	}
+	if info == nil {
+		return ""
+	}
+	for _, name := range l.Routes {
+		if info.Name == name {
+			return name
+		}
+	}
+	return ""
+}
+
+// window returns the window of time
+func (l *RateLimit) window() time.Duration {
+	if l.Window <= 0 {
+		return time.Second
+	}
+	return l.Window
+}
+
+// take takes a request from the quota of key
+func (l *RateLimit) take(key string) (rateLimitResult, error) {
+	var res rateLimitResult
+	now := l.now()
+	window := l.window()
+	limit := float64(l.Limit)
+	if l.Algorithm == SlidingWindow {
+		err := l.Store.Update(key, 2*window, func(s *RateLimitState) {
+			if elapsed := now.Sub(s.Start); elapsed >= window {
+				s.Prev = 0
+				if elapsed < 2*window {
+					s.Prev = s.Count
+				}
+				s.Count = 0
+				s.Start = now.Truncate(window)
+			}
+			elapsed := now.Sub(s.Start)
+			weight := 1 - float64(elapsed)/float64(window)
+			estimate := float64(s.Prev)*weight + float64(s.Count)
+			res.reset = window - elapsed
+			if estimate+1 <= limit {
+				s.Count++
+				res.allowed = true
+				estimate++
+			} else if s.Count+1 <= l.Limit && s.Prev > 0 {
+				// until the weight of the previous window decreases enough
+				res.retryAfter = time.Duration((1-(limit-1-float64(s.Count))/float64(s.Prev))*float64(window)) - elapsed
+			} else {
+				res.retryAfter = res.reset
+			}
+			if res.retryAfter < 0 {
+				res.retryAfter = 0
+			}
+			res.remaining = int(math.Max(0, math.Floor(limit-estimate)))
+		})
+		return res, err
+	}
+
+	burst := float64(l.Burst)
+	if burst <= 0 {
+		burst = limit
+	}
+	rate := limit / float64(window)
+	ttl := time.Duration(burst / rate)
+	err := l.Store.Update(key, ttl, func(s *RateLimitState) {
+		if s.Last.IsZero() {
+			s.Tokens = burst
+		} else {
+			s.Tokens = math.Min(burst, s.Tokens+float64(now.Sub(s.Last))*rate)
+		}
+		s.Last = now
+		if s.Tokens >= 1 {
+			s.Tokens--
+			res.allowed = true
+		} else {
+			res.retryAfter = time.Duration((1 - s.Tokens) / rate)
+		}
+		res.remaining = int(s.Tokens)
+		res.reset = time.Duration((burst - s.Tokens) / rate)
+	})
+	return res, err
+}
+
+// seconds returns d in seconds rounded up
+func seconds(d time.Duration) string {
+	return strconv.FormatInt(int64(math.Ceil(d.Seconds())), 10)
+}
@@ -0,0 +1,200 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/nbari/violetear/v7"
+)
+
+// clock returns a function returning the time that can be moved forward
+func clock() (func() time.Time, func(time.Duration)) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	return func() time.Time { return now }, func(d time.Duration) { now = now.Add(d) }
+}
+
+func TestRateLimitTokenBucket(t *testing.T) {
+	now, advance := clock()
+	limit := &RateLimit{Limit: 2, Window: time.Second, Burst: 3, now: now}
+	router := violetear.New()
+	router.Verbose = false
+	router.Use(limit.Handler)
+	router.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	})
+	router.HandleFunc("/other", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	})
+
+	get := func(path, addr string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", path, nil)
+		req.RemoteAddr = addr
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	for i, remaining := range []string{"2", "1", "0"} {
+		w := get("/", "10.0.0.1:1234")
+		if w.Code != http.StatusOK {
+			t.Fatalf("request %d: expected 200, got %d", i, w.Code)
+		}
+		if r := w.Header().Get("RateLimit-Remaining"); r != remaining {
+			t.Errorf("request %d: expected remaining %s, got %s", i, remaining, r)
+		}
+	}
+	w := get("/", "10.0.0.1:1234")
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected 429, got %d", w.Code)
+	}
+	for k, v := range map[string]string{
+		"RateLimit-Limit":     "2",
+		"RateLimit-Remaining": "0",
+		"RateLimit-Reset":     "2",
+		"RateLimit-Policy":    "2;w=1",
+		"Retry-After":         "1",
+	} {
+		if w.Header().Get(k) != v {
+			t.Errorf("expected %s %q, got %q", k, v, w.Header().Get(k))
+		}
+	}
+
+	// other clients and routes have their own quota
+	if w := get("/", "10.0.0.2:1234"); w.Code != http.StatusOK {
+		t.Errorf("expected 200 for other client, got %d", w.Code)
+	}
+	if w := get("/other", "10.0.0.1:1234"); w.Code != http.StatusOK {
+		t.Errorf("expected 200 for other route, got %d", w.Code)
+	}
+
+	// refilled at 2 tokens per second
+	advance(500 * time.Millisecond)
+	if w := get("/", "10.0.0.1:1234"); w.Code != http.StatusOK {
+		t.Errorf("expected 200 after refill, got %d", w.Code)
+	}
+	if w := get("/", "10.0.0.1:1234"); w.Code != http.StatusTooManyRequests {
+		t.Errorf("expected 429, got %d", w.Code)
+	}
+}
+
+func TestRateLimitSlidingWindow(t *testing.T) {
+	now, advance := clock()
+	limit := &RateLimit{
+		Limit:     4,
+		Window:    time.Minute,
+		Algorithm: SlidingWindow,
+		Key:       KeyByHeader("X-API-Key"),
+		Store:     NewMemoryStore(10),
+		now:       now,
+	}
+	h := limit.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	get := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/", nil)
+		req.Header.Set("X-API-Key", "key")
+		h.ServeHTTP(w, req)
+		return w
+	}
+
+	for i := 0; i < 4; i++ {
+		if w := get(); w.Code != http.StatusOK {
+			t.Fatalf("request %d: expected 200, got %d", i, w.Code)
+		}
+	}
+	w := get()
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected 429, got %d", w.Code)
+	}
+	if w.Header().Get("Retry-After") != "60" {
+		t.Errorf("expected Retry-After 60, got %q", w.Header().Get("Retry-After"))
+	}
+
+	// the previous window weights 3/4, 3 requests, 1 allowed
+	advance(75 * time.Second)
+	if w := get(); w.Code != http.StatusOK {
+		t.Errorf("expected 200, got %d", w.Code)
+	}
+	w = get()
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected 429, got %d", w.Code)
+	}
+	// until the previous window weights 1/2
+	if w.Header().Get("Retry-After") != "15" {
+		t.Errorf("expected Retry-After 15, got %q", w.Header().Get("Retry-After"))
+	}
+	advance(15 * time.Second)
+	if w := get(); w.Code != http.StatusOK {
+		t.Errorf("expected 200, got %d", w.Code)
+	}
+}
+
+func TestRateLimitRoutes(t *testing.T) {
+	limit := &RateLimit{
+		Limit:           1,
+		Window:          time.Hour,
+		Key:             KeyByParam("user"),
+		Routes:          []string{"login"},
+		ExceededHandler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusServiceUnavailable) }),
+	}
+	router := violetear.New()
+	router.Verbose = false
+	router.AddRegex(":user", `^\w+$`)
+	router.Use(limit.Handler)
+	router.HandleFunc("/login/:user", func(w http.ResponseWriter, r *http.Request) {}, "POST").Name("login")
+	router.HandleFunc("/home/:user", func(w http.ResponseWriter, r *http.Request) {}, "GET")
+
+	for _, tc := range []struct {
+		method, path string
+		code         int
+	}{
+		{"POST", "/login/alice", 200},
+		{"POST", "/login/alice", 503},
+		{"POST", "/login/bob", 200},
+		{"GET", "/home/alice", 200},
+		{"GET", "/home/alice", 200},
+		{"GET", "/none", 404},
+	} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(tc.method, tc.path, nil)
+		router.ServeHTTP(w, req)
+		if w.Code != tc.code {
+			t.Errorf("%s %s: expected %d, got %d", tc.method, tc.path, tc.code, w.Code)
+		}
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	now, advance := clock()
+	store := NewMemoryStore(3)
+	store.now = now
+	inc := func(s *RateLimitState) { s.Count++ }
+	for i := 0; i < 5; i++ {
+		store.Update(fmt.Sprintf("key%d", i), time.Minute, inc)
+	}
+	if store.Len() != 3 {
+		t.Errorf("expected 3 keys, got %d", store.Len())
+	}
+	var count int
+	store.Update("key4", time.Minute, func(s *RateLimitState) { count = s.Count })
+	if count != 1 {
+		t.Errorf("expected count 1, got %d", count)
+	}
+	// evicted
+	store.Update("key0", time.Minute, func(s *RateLimitState) { count = s.Count })
+	if count != 0 {
+		t.Errorf("expected evicted key, got count %d", count)
+	}
+
+	// expired
+	advance(2 * time.Minute)
+	store.Update("key4", time.Minute, func(s *RateLimitState) { count = s.Count })
+	if count != 0 {
+		t.Errorf("expected expired key, got count %d", count)
+	}
+	if store.Len() != 1 {
+		t.Errorf("expected 1 key, got %d", store.Len())
+	}
+}
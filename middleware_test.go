@@ -0,0 +1,186 @@
+package violetear
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// tag returns a middleware that writes its tag before and after calling the
+// next handler
+func tag(t string) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(t + ">"))
+			next.ServeHTTP(w, r)
+			w.Write([]byte("<" + t))
+		})
+	}
+}
+
+func TestRouteUse(t *testing.T) {
+	router := New()
+	router.Verbose = false
+	router.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("h"))
+	}, "GET,POST").Use(tag("m1"), tag("m2")).Use(tag("m3"))
+	router.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("put"))
+	}, "PUT")
+
+	tt := []struct {
+		method string
+		body   string
+	}{
+		{"GET", "m1>m2>m3>h<m3<m2<m1"},
+		{"POST", "m1>m2>m3>h<m3<m2<m1"},
+		{"PUT", "put"},
+	}
+	for _, tc := range tt {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(tc.method, "/", nil)
+		router.ServeHTTP(w, req)
+		expect(t, w.Body.String(), tc.body)
+	}
+
+	// failed routes are safe to chain
+	router.HandleFunc("/:none", func(w http.ResponseWriter, r *http.Request) {}).Use(tag("m1"))
+	expect(t, router.GetError() != nil, true)
+}
+
+func TestRouterUse(t *testing.T) {
+	router := New()
+	router.Verbose = false
+	router.AddRegex(":id", `^\d+$`)
+	router.Use(tag("r1"))
+	router.HandleFunc("/:id", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(GetParam("id", r)))
+	}, "GET").Use(tag("m1"))
+	router.HandleFunc("/panic", func(w http.ResponseWriter, r *http.Request) {
+		panic("panic")
+	})
+	router.Use(tag("r2"))
+	router.PanicErrorHandler = func(w http.ResponseWriter, r *http.Request, pe *PanicError) {
+		if !pe.HeaderWritten {
+			http.Error(w, pe.Error(), http.StatusInternalServerError)
+		}
+	}
+
+	tt := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+	}{
+		{"route", "GET", "/1", "r1>r2>m1>1<m1<r2<r1"},
+		{"not found", "GET", "/foo", "r1>r2>404 page not found\n<r2<r1"},
+		{"not allowed", "POST", "/1", "r1>r2>Method Not Allowed\n<r2<r1"},
+		// the header was written by the middleware before the panic
+		{"panic", "GET", "/panic", "r1>r2>r1>r2><r2<r1"},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest(tc.method, tc.path, nil)
+			router.ServeHTTP(w, req)
+			expect(t, w.Body.String(), tc.body)
+		})
+	}
+}
+
+func TestRouterUseHost(t *testing.T) {
+	router := New()
+	router.Verbose = false
+	api := router.Host("api.example.com")
+	api.Use(tag("api"))
+	api.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("h"))
+	})
+	router.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("h"))
+	})
+
+	get := func(host string) string {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/", nil)
+		req.Host = host
+		router.ServeHTTP(w, req)
+		return w.Body.String()
+	}
+	expect(t, get("api.example.com"), "api>h<api")
+	expect(t, get("example.com"), "h")
+
+	router.Use(tag("r"))
+	expect(t, get("api.example.com"), "r>api>h<api<r")
+	expect(t, get("example.com"), "r>h<r")
+}
+
+func TestRouterPre(t *testing.T) {
+	router := New()
+	router.Verbose = false
+	router.AddRegex(":id", `^\d+$`)
+
+	// strip locale prefix
+	router.Pre(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			expect(t, GetParam("id", r), "")
+			if strings.HasPrefix(r.URL.Path, "/en/") {
+				r2 := r.Clone(r.Context())
+				r2.URL.Path = strings.TrimPrefix(r.URL.Path, "/en")
+				r2.Header.Set("X-Locale", "en")
+				r = r2
+			}
+			next.ServeHTTP(w, r)
+		})
+	})
+	// normalize host
+	router.Pre(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Host == "www.example.com" {
+				r.Host = "example.com"
+			}
+			next.ServeHTTP(w, r)
+		})
+	})
+	// short-circuit
+	router.Pre(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/old" {
+				http.Redirect(w, r, "/new", http.StatusMovedPermanently)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	})
+	router.Use(tag("m"))
+	router.HandleFunc("/item/:id", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(GetParam("id", r) + r.Header.Get("X-Locale")))
+	})
+	router.Host("example.com").HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("example"))
+	})
+
+	tt := []struct {
+		name string
+		host string
+		path string
+		body string
+		code int
+	}{
+		{"no rewrite", "", "/item/1", "m>1<m", 200},
+		{"locale", "", "/en/item/2", "m>2en<m", 200},
+		{"host", "www.example.com", "/", "m>example<m", 200},
+		{"redirect", "", "/old", "<a href=\"/new\">Moved Permanently</a>.\n\n", 301},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", tc.path, nil)
+			req.Host = tc.host
+			router.ServeHTTP(w, req)
+			expect(t, w.Code, tc.code)
+			expect(t, w.Body.String(), tc.body)
+		})
+	}
+}
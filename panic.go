@@ -0,0 +1,106 @@
+package violetear
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"html"
+	"net/http"
+	"runtime/debug"
+	"strings"
+)
+
+// PanicError the value recovered from a panic while serving a request
+type PanicError struct {
+	// Value passed to panic
+	Value interface{}
+
+	// Stack of the goroutine that panicked
+	Stack []byte
+
+	// HeaderWritten true if the response header was already written when
+	// the panic happened, the status can't be changed. Only known when the
+	// router wraps the writer: LogRequests, TraceExporter, DevMode,
+	// PanicHandler or PanicErrorHandler set
+	HeaderWritten bool
+}
+
+// Error returns the recovered value
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("panic: %v", e.Value)
+}
+
+// Unwrap returns the recovered value if it is an error
+func (e *PanicError) Unwrap() error {
+	if err, ok := e.Value.(error); ok {
+		return err
+	}
+	return nil
+}
+
+// GetPanic returns the recovered panic, available in the PanicHandler
+func GetPanic(r *http.Request) *PanicError {
+	if pe, ok := r.Context().Value(PanicKey).(*PanicError); ok {
+		return pe
+	}
+	return nil
+}
+
+// recoverPanic logs the panic and serves the panic handler using w, the
+// writer of ww if not nil, must be called by the deferred function recovering the
+// panic to include its stack unless value is a PanicError with the stack
+// of the goroutine that panicked, example: a route with a timeout
+func (r *Router) recoverPanic(w http.ResponseWriter, ww *ResponseWriter, req *http.Request, value interface{}) {
+	pe, ok := value.(*PanicError)
+	if !ok || pe.Stack == nil {
+		pe = &PanicError{Value: value, Stack: debug.Stack()}
+	}
+	pe.HeaderWritten = ww != nil && ww.wroteHeader
+	r.log().Error("panic", "error", value, "method", req.Method, "url", req.URL.String(), "stack", string(pe.Stack))
+
+	req = req.WithContext(context.WithValue(req.Context(), PanicKey, pe))
+	var h http.Handler
+	switch {
+	case r.PanicErrorHandler != nil:
+		h = http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			r.PanicErrorHandler(w, req, pe)
+		})
+	case r.PanicHandler != nil:
+		h = r.PanicHandler
+	default:
+		h = http.HandlerFunc(r.panicPage)
+	}
+	r.serve(w, req, h, r)
+}
+
+// panicPage default panic handler, returns 500 unless the header was
+// already written, in DevMode the page includes the panic and the stack
+// using JSON or HTML depending on the Accept header
+func (r *Router) panicPage(w http.ResponseWriter, req *http.Request) {
+	pe := GetPanic(req)
+	if pe.HeaderWritten {
+		return
+	}
+	if !r.DevMode {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	if strings.Contains(req.Header.Get("Accept"), "json") {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": pe.Error(),
+			"stack": string(pe.Stack),
+		})
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusInternalServerError)
+	fmt.Fprintf(w, "<!DOCTYPE html>\n<html>\n<head><title>500 Internal Server Error</title></head>\n<body>\n<h1>%s</h1>\n<p>%s %s</p>\n<pre>%s</pre>\n</body>\n</html>\n",
+		html.EscapeString(pe.Error()),
+		html.EscapeString(req.Method),
+		html.EscapeString(req.URL.String()),
+		html.EscapeString(string(pe.Stack)),
+	)
+}
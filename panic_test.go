@@ -0,0 +1,122 @@
+package violetear
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// newPanicRouter returns a router with routes that panic
+func newPanicRouter() *Router {
+	router := New()
+	router.Verbose = false
+	router.Slog = slog.New(slog.NewTextHandler(io.Discard, nil))
+	router.HandleFunc("/panic", func(w http.ResponseWriter, r *http.Request) {
+		panic("<ja ja ja>")
+	})
+	router.HandleFunc("/written", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+		w.Write([]byte("partial"))
+		panic(errors.New("after write"))
+	})
+	router.HandleFunc("/abort", func(w http.ResponseWriter, r *http.Request) {
+		panic(http.ErrAbortHandler)
+	})
+	return router
+}
+
+func TestPanicErrorHandler(t *testing.T) {
+	router := newPanicRouter()
+	var pe *PanicError
+	router.PanicErrorHandler = func(w http.ResponseWriter, r *http.Request, err *PanicError) {
+		pe = err
+		expect(t, GetPanic(r), err)
+		if !err.HeaderWritten {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/panic", nil)
+	router.ServeHTTP(w, req)
+	expect(t, w.Code, http.StatusInternalServerError)
+	expect(t, w.Body.String(), "panic: <ja ja ja>\n")
+	expect(t, pe.Value, "<ja ja ja>")
+	expect(t, pe.HeaderWritten, false)
+	expect(t, strings.Contains(string(pe.Stack), "panic_test.go"), true)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/written", nil)
+	router.ServeHTTP(w, req)
+	expect(t, w.Code, http.StatusAccepted)
+	expect(t, w.Body.String(), "partial")
+	expect(t, pe.HeaderWritten, true)
+	expect(t, pe.Unwrap().Error(), "after write")
+}
+
+func TestPanicHandlerGetPanic(t *testing.T) {
+	router := newPanicRouter()
+	router.PanicHandler = func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, GetPanic(r).Error(), http.StatusInternalServerError)
+	}
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/panic", nil)
+	router.ServeHTTP(w, req)
+	expect(t, w.Body.String(), "panic: <ja ja ja>\n")
+	expect(t, GetPanic(req) == nil, true)
+}
+
+func TestPanicHeaderWritten(t *testing.T) {
+	router := newPanicRouter()
+	// the writer is wrapped when logging
+	router.LogRequests = true
+	router.Logger = func(*ResponseWriter, *http.Request) {}
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/written", nil)
+	router.ServeHTTP(w, req)
+	expect(t, w.Code, http.StatusAccepted)
+	expect(t, w.Body.String(), "partial")
+}
+
+func TestPanicAbortHandler(t *testing.T) {
+	router := newPanicRouter()
+	called := false
+	router.PanicHandler = func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}
+	defer func() {
+		expect(t, recover(), http.ErrAbortHandler)
+		expect(t, called, false)
+	}()
+	req, _ := http.NewRequest("GET", "/abort", nil)
+	router.ServeHTTP(httptest.NewRecorder(), req)
+}
+
+func TestPanicDevMode(t *testing.T) {
+	router := newPanicRouter()
+	router.DevMode = true
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/panic", nil)
+	router.ServeHTTP(w, req)
+	expect(t, w.Code, http.StatusInternalServerError)
+	expect(t, w.Header().Get("Content-Type"), "text/html; charset=utf-8")
+	expect(t, strings.Contains(w.Body.String(), "<h1>panic: &lt;ja ja ja&gt;</h1>"), true)
+	expect(t, strings.Contains(w.Body.String(), "panic_test.go"), true)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/panic", nil)
+	req.Header.Set("Accept", "application/json")
+	router.ServeHTTP(w, req)
+	expect(t, w.Code, http.StatusInternalServerError)
+	expect(t, w.Header().Get("Content-Type"), "application/json; charset=utf-8")
+	var body map[string]string
+	expect(t, json.NewDecoder(w.Body).Decode(&body), nil)
+	expect(t, body["error"], "panic: <ja ja ja>")
+	expect(t, strings.Contains(body["stack"], "panic_test.go"), true)
+}
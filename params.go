@@ -78,3 +78,21 @@ func GetRouteName(r *http.Request) string {
 	}
 	return ""
 }
+
+// GetRouteInfo returns the route matched by the request, nil if no route
+// was matched
+func GetRouteInfo(r *http.Request) *RouteInfo {
+	if info, ok := r.Context().Value(RouteKey).(*RouteInfo); ok {
+		return info
+	}
+	return nil
+}
+
+// GetRoutePattern returns the pattern of the route matched by the request,
+// example: /root/:uuid/item
+func GetRoutePattern(r *http.Request) string {
+	if info := GetRouteInfo(r); info != nil {
+		return info.Pattern
+	}
+	return ""
+}
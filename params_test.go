@@ -1,6 +1,7 @@
 package violetear
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
@@ -396,3 +397,73 @@ func TestGetParamsWildcard(t *testing.T) {
 	req, _ := http.NewRequest("GET", "/test/foo/bar/xxxx", nil)
 	router.ServeHTTP(w, req)
 }
+
+func TestGetRouteInfo(t *testing.T) {
+	router := New()
+	router.Verbose = false
+	router.AddRegex(":uuid", `^[0-9a-f-]{36}$`)
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		info := GetRouteInfo(r)
+		w.Write([]byte(fmt.Sprintf("%s|%s|%v|%s|%s", info.Name, info.Pattern, info.Methods, info.Version, info.Host)))
+	}
+	router.HandleFunc("/", handler)
+	router.HandleFunc("/root/:uuid/item", handler, "post, PUT").Name("item")
+	router.HandleFunc("/root/:uuid/item", handler, "GET")
+	router.HandleFunc("/root/:uuid/item#v2", handler, "GET")
+	router.HandleFunc("/static/*", handler, "GET")
+	router.Host("api.example.com").HandleFunc("/users", handler)
+	router.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-Pattern", GetRoutePattern(r))
+			next.ServeHTTP(w, r)
+		})
+	})
+
+	uuid := "a7ef71b0-3ab4-4c2e-a0b4-8ed5a20e0f63"
+	tt := []struct {
+		method  string
+		host    string
+		path    string
+		accept  string
+		body    string
+		pattern string
+	}{
+		{"GET", "", "/", "", "|/|[ALL]||", "/"},
+		{"PUT", "", "/root/" + uuid + "/item", "", "item|/root/:uuid/item|[POST PUT]||", "/root/:uuid/item"},
+		{"GET", "", "/root/" + uuid + "/item", "", "item|/root/:uuid/item|[GET]||", "/root/:uuid/item"},
+		{"GET", "", "/root/" + uuid + "/item", "application/vnd.v2", "|/root/:uuid/item|[GET]|v2|", "/root/:uuid/item"},
+		{"GET", "", "/static/css/main.css", "", "|/static/*|[GET]||", "/static/*"},
+		{"GET", "api.example.com", "/users", "", "|/users|[ALL]||api.example.com", "/users"},
+		{"GET", "", "/not-found", "", "404 page not found\n", ""},
+		{"DELETE", "", "/root/" + uuid + "/item", "", "Method Not Allowed\n", ""},
+	}
+	for _, tc := range tt {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(tc.method, tc.path, nil)
+		req.Host = tc.host
+		if tc.accept != "" {
+			req.Header.Set("Accept", tc.accept)
+		}
+		router.ServeHTTP(w, req)
+		expect(t, w.Body.String(), tc.body)
+		expect(t, w.Header().Get("X-Pattern"), tc.pattern)
+	}
+
+	req, _ := http.NewRequest("GET", "/", nil)
+	expect(t, GetRouteInfo(req) == nil, true)
+	expect(t, GetRoutePattern(req), "")
+}
+
+func TestRouteContext(t *testing.T) {
+	info := &RouteInfo{Pattern: "/"}
+	parent := context.WithValue(context.Background(), ParamsKey, Params{":id": "1"})
+	ctx := &routeContext{Context: parent, info: info}
+	expect(t, ctx.Value(RouteKey), info)
+	// no params, the ones of the parent are kept
+	expect(t, ctx.Value(ParamsKey).(Params)[":id"], "1")
+	expect(t, ctx.Value(RequestIDKey), nil)
+
+	ctx = &routeContext{Context: context.Background(), params: Params{":id": "2"}}
+	expect(t, ctx.Value(ParamsKey).(Params)[":id"], "2")
+	expect(t, ctx.Value(RouteKey), nil)
+}
@@ -0,0 +1,147 @@
+package violetear
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"net"
+	"net/http"
+	"time"
+)
+
+// crockford alphabet used by ULID
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// requestID returns the request ID and the request carrying it in the
+// context and in the RequestID header, a new one is generated if the
+// request doesn't have one or it is not trusted, the untrusted IDs are
+// removed from the header
+func (r *Router) requestID(req *http.Request) (string, *http.Request) {
+	rid := req.Header.Get(r.RequestID)
+	rejected := false
+	if rid != "" && r.TrustRequestID != nil && !r.TrustRequestID(rid, req) {
+		rid, rejected = "", true
+	}
+	generated := false
+	if rid == "" && r.GenerateRequestID != nil {
+		rid, generated = r.GenerateRequestID(), true
+	}
+	if rid == "" {
+		if rejected {
+			r2 := *req
+			r2.Header = req.Header.Clone()
+			r2.Header.Del(r.RequestID)
+			req = &r2
+		}
+		return "", req
+	}
+	req = req.WithContext(context.WithValue(req.Context(), RequestIDKey, rid))
+	if generated || req.Header.Get(r.RequestID) != rid {
+		// forward the ID to the next handlers without modifying the
+		// headers of the original request
+		req.Header = req.Header.Clone()
+		req.Header.Set(r.RequestID, rid)
+	}
+	return rid, req
+}
+
+// GetRequestID returns the request ID, empty if the router has no RequestID
+// header or the request doesn't have one
+func GetRequestID(r *http.Request) string {
+	if rid, ok := r.Context().Value(RequestIDKey).(string); ok {
+		return rid
+	}
+	return ""
+}
+
+// UUIDv4 returns a random UUID (version 4)
+func UUIDv4() string {
+	var b [16]byte
+	rand.Read(b[:])
+	return formatUUID(b, 4)
+}
+
+// UUIDv7 returns a time ordered UUID (version 7)
+func UUIDv7() string {
+	var b [16]byte
+	rand.Read(b[6:])
+	ms := uint64(time.Now().UnixMilli())
+	b[0], b[1], b[2] = byte(ms>>40), byte(ms>>32), byte(ms>>24)
+	b[3], b[4], b[5] = byte(ms>>16), byte(ms>>8), byte(ms)
+	return formatUUID(b, 7)
+}
+
+// formatUUID sets the version and variant and returns the canonical form
+func formatUUID(b [16]byte, version byte) string {
+	b[6] = b[6]&0x0f | version<<4
+	b[8] = b[8]&0x3f | 0x80
+	var s [36]byte
+	hex.Encode(s[0:8], b[0:4])
+	hex.Encode(s[9:13], b[4:6])
+	hex.Encode(s[14:18], b[6:8])
+	hex.Encode(s[19:23], b[8:10])
+	hex.Encode(s[24:], b[10:])
+	s[8], s[13], s[18], s[23] = '-', '-', '-', '-'
+	return string(s[:])
+}
+
+// ULID returns a Universally Unique Lexicographically Sortable Identifier,
+// 48 bits of time in milliseconds and 80 random bits encoded in 26
+// characters using Crockford's base32
+func ULID() string {
+	var b [16]byte
+	binary.BigEndian.PutUint64(b[:8], uint64(time.Now().UnixMilli())<<16)
+	rand.Read(b[6:])
+	hi, lo := binary.BigEndian.Uint64(b[:8]), binary.BigEndian.Uint64(b[8:])
+	var s [26]byte
+	for i := 25; i >= 0; i-- {
+		s[i] = crockford[lo&31]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+	return string(s[:])
+}
+
+// ValidRequestID a TrustRequestID policy accepting IDs of up to 128
+// characters using only letters, digits and -_.:/+=
+func ValidRequestID(id string, r *http.Request) bool {
+	if len(id) > 128 {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		c := id[i]
+		if !('a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9') &&
+			c != '-' && c != '_' && c != '.' && c != ':' && c != '/' && c != '+' && c != '=' {
+			return false
+		}
+	}
+	return true
+}
+
+// TrustNetworks returns a TrustRequestID policy accepting the IDs only from
+// the given networks (CIDR), example: the load balancer
+//  trust, err := violetear.TrustNetworks("10.0.0.0/8")
+//  router.TrustRequestID = trust
+func TrustNetworks(cidrs ...string) (func(string, *http.Request) bool, error) {
+	networks := make([]*net.IPNet, len(cidrs))
+	for i, cidr := range cidrs {
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, err
+		}
+		networks[i] = n
+	}
+	return func(id string, r *http.Request) bool {
+		ip := net.ParseIP(remoteHost(r.RemoteAddr))
+		if ip == nil {
+			return false
+		}
+		for _, n := range networks {
+			if n.Contains(ip) {
+				return ValidRequestID(id, r)
+			}
+		}
+		return false
+	}, nil
+}
@@ -0,0 +1,128 @@
+package violetear
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestRequestIDGenerate(t *testing.T) {
+	trust, err := TrustNetworks("10.0.0.0/8")
+	expect(t, err, nil)
+
+	tt := []struct {
+		name       string
+		trust      func(string, *http.Request) bool
+		remoteAddr string
+		header     string
+		expect     string
+	}{
+		{"generate", nil, "127.0.0.1:1234", "", "generated"},
+		{"trust all", nil, "127.0.0.1:1234", "abc", "abc"},
+		{"valid", ValidRequestID, "127.0.0.1:1234", "abc-123", "abc-123"},
+		{"invalid", ValidRequestID, "127.0.0.1:1234", "abc 123", "generated"},
+		{"trusted network", trust, "10.1.2.3:1234", "abc", "abc"},
+		{"untrusted network", trust, "192.168.1.1:1234", "abc", "generated"},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			router := New()
+			router.Verbose = false
+			router.LogRequests = true
+			router.RequestID = "Request-ID"
+			router.GenerateRequestID = func() string { return "generated" }
+			router.TrustRequestID = tc.trust
+			router.Logger = func(w *ResponseWriter, r *http.Request) {
+				expect(t, w.RequestID(), tc.expect)
+			}
+			router.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+				expect(t, GetRequestID(r), tc.expect)
+				expect(t, r.Header.Get("Request-ID"), tc.expect)
+			})
+
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "/", nil)
+			req.RemoteAddr = tc.remoteAddr
+			if tc.header != "" {
+				req.Header.Set("Request-ID", tc.header)
+			}
+			router.ServeHTTP(w, req)
+			expect(t, w.Code, 200)
+			expect(t, w.Header().Get("Request-ID"), tc.expect)
+			// the original request is not modified
+			expect(t, req.Header.Get("Request-ID"), tc.header)
+		})
+	}
+}
+
+func TestRequestIDRejected(t *testing.T) {
+	router := New()
+	router.Verbose = false
+	router.RequestID = "X-Request-ID"
+	router.TrustRequestID = ValidRequestID
+	router.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		expect(t, GetRequestID(r), "")
+		_, ok := r.Header["X-Request-Id"]
+		expect(t, ok, false)
+	})
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/", nil)
+	req.Header.Set("X-Request-ID", "bad id <script>")
+	router.ServeHTTP(w, req)
+	expect(t, w.Code, 200)
+	expect(t, w.Header().Get("X-Request-ID"), "")
+	// the original request is not modified
+	expect(t, req.Header.Get("X-Request-ID"), "bad id <script>")
+}
+
+func TestRequestIDNotSet(t *testing.T) {
+	router := New()
+	router.Verbose = false
+	router.GenerateRequestID = UUIDv4
+	router.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		expect(t, GetRequestID(r), "")
+	})
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/", nil)
+	router.ServeHTTP(w, req)
+	expect(t, w.Code, 200)
+}
+
+func TestRequestIDGenerators(t *testing.T) {
+	tt := []struct {
+		name     string
+		generate func() string
+		format   *regexp.Regexp
+	}{
+		{"UUIDv4", UUIDv4, regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)},
+		{"UUIDv7", UUIDv7, regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-7[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)},
+		{"ULID", ULID, regexp.MustCompile(`^[0-7][0-9A-HJKMNP-TV-Z]{25}$`)},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			a, b := tc.generate(), tc.generate()
+			expect(t, tc.format.MatchString(a), true)
+			expect(t, a != b, true)
+		})
+	}
+
+	// time ordered
+	a := UUIDv7()
+	b := ULID()
+	for i := 0; i < 2; i++ {
+		time.Sleep(2 * time.Millisecond)
+		next := UUIDv7()
+		expect(t, next[:13] > a[:13], true)
+		a = next
+		nextULID := ULID()
+		expect(t, nextULID[:10] > b[:10], true)
+		b = nextULID
+	}
+}
+
+func TestTrustNetworksError(t *testing.T) {
+	_, err := TrustNetworks("10.0.0.0/33")
+	expect(t, err != nil, true)
+}
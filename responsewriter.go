@@ -1,7 +1,11 @@
 package violetear
 
 import (
+	"bufio"
+	"io"
+	"net"
 	"net/http"
+	"sync/atomic"
 	"time"
 )
 
@@ -10,10 +14,17 @@ type ResponseWriter struct {
 	http.ResponseWriter
 	requestID    string
 	size, status int
-	start        time.Time
+	start, end   time.Time
+	firstByte    time.Time
+	route        *RouteInfo
+	wroteHeader  bool
+	hijacked     bool
+	aborted      bool
+	bytesRead    int64
 }
 
-// NewResponseWriter returns ResponseWriter
+// NewResponseWriter returns ResponseWriter, it doesn't implement the
+// optional interfaces of w, use WrapResponseWriter to keep them
 func NewResponseWriter(w http.ResponseWriter, rid string) *ResponseWriter {
 	return &ResponseWriter{
 		ResponseWriter: w,
@@ -23,8 +34,12 @@ func NewResponseWriter(w http.ResponseWriter, rid string) *ResponseWriter {
 	}
 }
 
-// Status provides an easy way to retrieve the status code
+// Status provides an easy way to retrieve the status code, 101 (Switching
+// Protocols) if the connection was hijacked before writing the header
 func (w *ResponseWriter) Status() int {
+	if w.hijacked && !w.wroteHeader {
+		return http.StatusSwitchingProtocols
+	}
 	return w.status
 }
 
@@ -35,7 +50,53 @@ func (w *ResponseWriter) Size() int {
 
 // RequestTime return the request time
 func (w *ResponseWriter) RequestTime() string {
-	return time.Since(w.start).String()
+	return w.Duration().String()
+}
+
+// Duration returns the time taken to serve the request, the time elapsed
+// if the request is still being served
+func (w *ResponseWriter) Duration() time.Duration {
+	if w.end.IsZero() {
+		return time.Since(w.start)
+	}
+	return w.end.Sub(w.start)
+}
+
+// TTFB returns the time to the first byte, the time elapsed until the
+// header was written, 0 if it was not written
+func (w *ResponseWriter) TTFB() time.Duration {
+	if w.firstByte.IsZero() {
+		return 0
+	}
+	return w.firstByte.Sub(w.start)
+}
+
+// WroteHeader reports whether the header was written
+func (w *ResponseWriter) WroteHeader() bool {
+	return w.wroteHeader
+}
+
+// BytesRead returns the bytes of the request body read by the handler,
+// only counted by the router when LogRequests is set
+func (w *ResponseWriter) BytesRead() int64 {
+	return atomic.LoadInt64(&w.bytesRead)
+}
+
+// Hijacked reports whether the connection was hijacked, example: WebSocket
+func (w *ResponseWriter) Hijacked() bool {
+	return w.hijacked
+}
+
+// Aborted reports whether the response was aborted, by panicking with
+// http.ErrAbortHandler or because the client went away
+func (w *ResponseWriter) Aborted() bool {
+	return w.aborted
+}
+
+// Route returns the route matched by the request, nil if no route was
+// matched
+func (w *ResponseWriter) Route() *RouteInfo {
+	return w.route
 }
 
 // RequestID retrieve the Request ID
@@ -46,14 +107,236 @@ func (w *ResponseWriter) RequestID() string {
 // Write satisfies the http.ResponseWriter interface and
 // captures data written, in bytes
 func (w *ResponseWriter) Write(data []byte) (int, error) {
+	w.writeHeader()
 	size, err := w.ResponseWriter.Write(data)
 	w.size += size
 	return size, err
 }
 
 // WriteHeader satisfies the http.ResponseWriter interface and
-// allows us to catch the status code
+// allows us to catch the status code, superfluous calls are ignored
 func (w *ResponseWriter) WriteHeader(statusCode int) {
+	if w.wroteHeader {
+		return
+	}
+	// informational headers can be written before the final one
+	if statusCode >= 100 && statusCode < 200 && statusCode != http.StatusSwitchingProtocols {
+		w.ResponseWriter.WriteHeader(statusCode)
+		return
+	}
 	w.status = statusCode
+	w.writeHeader()
 	w.ResponseWriter.WriteHeader(statusCode)
 }
+
+// writeHeader marks the header as written
+func (w *ResponseWriter) writeHeader() {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		w.firstByte = time.Now()
+	}
+}
+
+// countBody counts the bytes read from the request body
+type countBody struct {
+	io.ReadCloser
+	w *ResponseWriter
+}
+
+// Read reads from the request body
+func (b *countBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	atomic.AddInt64(&b.w.bytesRead, int64(n))
+	return n, err
+}
+
+// Unwrap returns the wrapped http.ResponseWriter, used by
+// http.ResponseController
+func (w *ResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// responseWriter returns the ResponseWriter, promoted to the writers
+// returned by WrapResponseWriter
+func (w *ResponseWriter) responseWriter() *ResponseWriter {
+	return w
+}
+
+// flush implements http.Flusher
+func (w *ResponseWriter) flush() {
+	w.writeHeader()
+	w.ResponseWriter.(http.Flusher).Flush()
+}
+
+// hijack implements http.Hijacker
+func (w *ResponseWriter) hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, rw, err := w.ResponseWriter.(http.Hijacker).Hijack()
+	if err == nil {
+		w.hijacked = true
+	}
+	return conn, rw, err
+}
+
+// push implements http.Pusher
+func (w *ResponseWriter) push(target string, opts *http.PushOptions) error {
+	return w.ResponseWriter.(http.Pusher).Push(target, opts)
+}
+
+// readFrom implements io.ReaderFrom and captures the data written
+func (w *ResponseWriter) readFrom(r io.Reader) (int64, error) {
+	w.writeHeader()
+	n, err := w.ResponseWriter.(io.ReaderFrom).ReadFrom(r)
+	w.size += int(n)
+	return n, err
+}
+
+type flusher struct{ w *ResponseWriter }
+
+func (f flusher) Flush() { f.w.flush() }
+
+type hijacker struct{ w *ResponseWriter }
+
+func (h hijacker) Hijack() (net.Conn, *bufio.ReadWriter, error) { return h.w.hijack() }
+
+type pusher struct{ w *ResponseWriter }
+
+func (p pusher) Push(target string, opts *http.PushOptions) error { return p.w.push(target, opts) }
+
+type readerFrom struct{ w *ResponseWriter }
+
+func (r readerFrom) ReadFrom(src io.Reader) (int64, error) { return r.w.readFrom(src) }
+
+// WrapResponseWriter returns a ResponseWriter capturing the status and size
+// of the response and an http.ResponseWriter using it that implements the
+// same optional interfaces as w (http.Flusher, http.Hijacker, http.Pusher
+// and io.ReaderFrom), the latter must be passed to the handlers, example:
+//  hw, ww := violetear.WrapResponseWriter(w, "")
+//  next.ServeHTTP(hw, r)
+//  log.Println(ww.Status())
+func WrapResponseWriter(w http.ResponseWriter, rid string) (http.ResponseWriter, *ResponseWriter) {
+	ww := NewResponseWriter(w, rid)
+	var mask int
+	if _, ok := w.(http.Flusher); ok {
+		mask |= 1
+	}
+	if _, ok := w.(http.Hijacker); ok {
+		mask |= 2
+	}
+	if _, ok := w.(http.Pusher); ok {
+		mask |= 4
+	}
+	if _, ok := w.(io.ReaderFrom); ok {
+		mask |= 8
+	}
+	f, h, p, rf := flusher{ww}, hijacker{ww}, pusher{ww}, readerFrom{ww}
+	switch mask {
+	case 1:
+		return struct {
+			*ResponseWriter
+			http.Flusher
+		}{ww, f}, ww
+	case 2:
+		return struct {
+			*ResponseWriter
+			http.Hijacker
+		}{ww, h}, ww
+	case 3:
+		return struct {
+			*ResponseWriter
+			http.Flusher
+			http.Hijacker
+		}{ww, f, h}, ww
+	case 4:
+		return struct {
+			*ResponseWriter
+			http.Pusher
+		}{ww, p}, ww
+	case 5:
+		return struct {
+			*ResponseWriter
+			http.Flusher
+			http.Pusher
+		}{ww, f, p}, ww
+	case 6:
+		return struct {
+			*ResponseWriter
+			http.Hijacker
+			http.Pusher
+		}{ww, h, p}, ww
+	case 7:
+		return struct {
+			*ResponseWriter
+			http.Flusher
+			http.Hijacker
+			http.Pusher
+		}{ww, f, h, p}, ww
+	case 8:
+		return struct {
+			*ResponseWriter
+			io.ReaderFrom
+		}{ww, rf}, ww
+	case 9:
+		return struct {
+			*ResponseWriter
+			http.Flusher
+			io.ReaderFrom
+		}{ww, f, rf}, ww
+	case 10:
+		return struct {
+			*ResponseWriter
+			http.Hijacker
+			io.ReaderFrom
+		}{ww, h, rf}, ww
+	case 11:
+		return struct {
+			*ResponseWriter
+			http.Flusher
+			http.Hijacker
+			io.ReaderFrom
+		}{ww, f, h, rf}, ww
+	case 12:
+		return struct {
+			*ResponseWriter
+			http.Pusher
+			io.ReaderFrom
+		}{ww, p, rf}, ww
+	case 13:
+		return struct {
+			*ResponseWriter
+			http.Flusher
+			http.Pusher
+			io.ReaderFrom
+		}{ww, f, p, rf}, ww
+	case 14:
+		return struct {
+			*ResponseWriter
+			http.Hijacker
+			http.Pusher
+			io.ReaderFrom
+		}{ww, h, p, rf}, ww
+	case 15:
+		return struct {
+			*ResponseWriter
+			http.Flusher
+			http.Hijacker
+			http.Pusher
+			io.ReaderFrom
+		}{ww, f, h, p, rf}, ww
+	}
+	return ww, ww
+}
+
+// GetResponseWriter returns the ResponseWriter used by w, nil if w doesn't
+// use one, the writers implementing Unwrap are unwrapped to find it
+func GetResponseWriter(w http.ResponseWriter) *ResponseWriter {
+	for {
+		switch rw := w.(type) {
+		case interface{ responseWriter() *ResponseWriter }:
+			return rw.responseWriter()
+		case interface{ Unwrap() http.ResponseWriter }:
+			w = rw.Unwrap()
+		default:
+			return nil
+		}
+	}
+}
@@ -1,8 +1,14 @@
 package violetear
 
 import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 )
@@ -144,3 +150,313 @@ func TestResponseWriterLoggerCloseConnection(t *testing.T) {
 	}
 	client.Get(ts.URL)
 }
+
+// testWriter records the calls to the optional interfaces
+type testWriter struct {
+	*httptest.ResponseRecorder
+	calls []string
+}
+
+type testFlusher struct{ w *testWriter }
+
+func (f testFlusher) Flush() { f.w.calls = append(f.w.calls, "flush") }
+
+type testHijacker struct{ w *testWriter }
+
+func (h testHijacker) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h.w.calls = append(h.w.calls, "hijack")
+	return nil, nil, nil
+}
+
+type testPusher struct{ w *testWriter }
+
+func (p testPusher) Push(target string, opts *http.PushOptions) error {
+	p.w.calls = append(p.w.calls, "push")
+	return nil
+}
+
+type testReaderFrom struct{ w *testWriter }
+
+func (r testReaderFrom) ReadFrom(src io.Reader) (int64, error) {
+	r.w.calls = append(r.w.calls, "readfrom")
+	return io.Copy(r.w.ResponseRecorder.Body, src)
+}
+
+// newTestWriter returns a writer implementing the optional interfaces
+// selected by mask: 1 Flusher, 2 Hijacker, 4 Pusher, 8 ReaderFrom
+func newTestWriter(mask int) (http.ResponseWriter, *testWriter) {
+	tw := &testWriter{ResponseRecorder: httptest.NewRecorder()}
+	// hide the Flush method of the recorder
+	base := struct {
+		http.ResponseWriter
+	}{tw}
+	f, h, p, rf := testFlusher{tw}, testHijacker{tw}, testPusher{tw}, testReaderFrom{tw}
+	type (
+		F  = http.Flusher
+		H  = http.Hijacker
+		P  = http.Pusher
+		RF = io.ReaderFrom
+		W  = http.ResponseWriter
+	)
+	switch mask {
+	case 1:
+		return struct {
+			W
+			F
+		}{base, f}, tw
+	case 2:
+		return struct {
+			W
+			H
+		}{base, h}, tw
+	case 3:
+		return struct {
+			W
+			F
+			H
+		}{base, f, h}, tw
+	case 4:
+		return struct {
+			W
+			P
+		}{base, p}, tw
+	case 5:
+		return struct {
+			W
+			F
+			P
+		}{base, f, p}, tw
+	case 6:
+		return struct {
+			W
+			H
+			P
+		}{base, h, p}, tw
+	case 7:
+		return struct {
+			W
+			F
+			H
+			P
+		}{base, f, h, p}, tw
+	case 8:
+		return struct {
+			W
+			RF
+		}{base, rf}, tw
+	case 9:
+		return struct {
+			W
+			F
+			RF
+		}{base, f, rf}, tw
+	case 10:
+		return struct {
+			W
+			H
+			RF
+		}{base, h, rf}, tw
+	case 11:
+		return struct {
+			W
+			F
+			H
+			RF
+		}{base, f, h, rf}, tw
+	case 12:
+		return struct {
+			W
+			P
+			RF
+		}{base, p, rf}, tw
+	case 13:
+		return struct {
+			W
+			F
+			P
+			RF
+		}{base, f, p, rf}, tw
+	case 14:
+		return struct {
+			W
+			H
+			P
+			RF
+		}{base, h, p, rf}, tw
+	case 15:
+		return struct {
+			W
+			F
+			H
+			P
+			RF
+		}{base, f, h, p, rf}, tw
+	}
+	return base, tw
+}
+
+func TestWrapResponseWriter(t *testing.T) {
+	for mask := 0; mask < 16; mask++ {
+		t.Run(fmt.Sprintf("mask %04b", mask), func(t *testing.T) {
+			w, tw := newTestWriter(mask)
+			hw, ww := WrapResponseWriter(w, "rid")
+			expect(t, GetResponseWriter(hw), ww)
+			expect(t, hw.(interface{ Unwrap() http.ResponseWriter }).Unwrap(), w)
+			expect(t, ww.RequestID(), "rid")
+
+			var calls []string
+			f, ok := hw.(http.Flusher)
+			expect(t, ok, mask&1 != 0)
+			if ok {
+				f.Flush()
+				calls = append(calls, "flush")
+			}
+			h, ok := hw.(http.Hijacker)
+			expect(t, ok, mask&2 != 0)
+			if ok {
+				h.Hijack()
+				calls = append(calls, "hijack")
+			}
+			p, ok := hw.(http.Pusher)
+			expect(t, ok, mask&4 != 0)
+			if ok {
+				p.Push("/style.css", nil)
+				calls = append(calls, "push")
+			}
+			rf, ok := hw.(io.ReaderFrom)
+			expect(t, ok, mask&8 != 0)
+			if ok {
+				rf.ReadFrom(strings.NewReader("abc"))
+				calls = append(calls, "readfrom")
+				expect(t, ww.Size(), 3)
+			}
+			expectDeepEqual(t, tw.calls, calls)
+
+			// http.ResponseController finds the interfaces unwrapping
+			err := http.NewResponseController(hw).Flush()
+			expect(t, err == nil, mask&1 != 0)
+		})
+	}
+}
+
+func TestWrapResponseWriterRouter(t *testing.T) {
+	router := New()
+	router.Verbose = false
+	router.LogRequests = true
+	router.Logger = func(w *ResponseWriter, r *http.Request) {
+		expect(t, w.Status(), http.StatusOK)
+		expect(t, w.Size(), 4)
+	}
+	router.HandleFunc("/events", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("data"))
+		_, ok := w.(http.Flusher)
+		expect(t, ok, true)
+		_, ok = w.(http.Hijacker)
+		expect(t, ok, false)
+		expect(t, GetResponseWriter(w) != nil, true)
+	})
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/events", nil)
+	router.ServeHTTP(w, req)
+	expect(t, w.Flushed, false)
+	expect(t, w.Body.String(), "data")
+	expect(t, GetResponseWriter(w) == nil, true)
+}
+
+func TestRouterWriterNotWrapped(t *testing.T) {
+	router := New()
+	router.Verbose = false
+	rec := httptest.NewRecorder()
+	router.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		// nothing uses the state of the response
+		expect(t, w, http.ResponseWriter(rec))
+		_, ok := r.Body.(*countBody)
+		expect(t, ok, false)
+	})
+	req, _ := http.NewRequest("POST", "/", strings.NewReader("body"))
+	router.ServeHTTP(rec, req)
+	expect(t, rec.Code, http.StatusOK)
+
+	// the route context is the only allocation
+	router.HandleFunc("/empty", func(w http.ResponseWriter, r *http.Request) {})
+	allocs := testing.AllocsPerRun(100, func() {
+		req, _ := http.NewRequest("GET", "/empty", nil)
+		router.ServeHTTP(rec, req)
+	}) - testing.AllocsPerRun(100, func() {
+		http.NewRequest("GET", "/empty", nil)
+	})
+	expect(t, allocs <= 2, true)
+}
+
+func TestResponseWriterSuperfluousWriteHeader(t *testing.T) {
+	rec := httptest.NewRecorder()
+	rw := NewResponseWriter(rec, "")
+	expect(t, rw.WroteHeader(), false)
+	expect(t, rw.TTFB(), time.Duration(0))
+
+	rw.WriteHeader(http.StatusEarlyHints)
+	expect(t, rw.WroteHeader(), false)
+
+	rw.WriteHeader(http.StatusCreated)
+	rw.WriteHeader(http.StatusInternalServerError)
+	rw.Write([]byte("a"))
+	expect(t, rw.WroteHeader(), true)
+	expect(t, rw.Status(), http.StatusCreated)
+	expect(t, rw.TTFB() > 0, true)
+	expect(t, rw.TTFB() <= rw.Duration(), true)
+}
+
+func TestResponseWriterHijacked(t *testing.T) {
+	w, _ := newTestWriter(2)
+	hw, ww := WrapResponseWriter(w, "")
+	expect(t, ww.Hijacked(), false)
+	hw.(http.Hijacker).Hijack()
+	expect(t, ww.Hijacked(), true)
+	expect(t, ww.Status(), http.StatusSwitchingProtocols)
+}
+
+func TestResponseWriterCapture(t *testing.T) {
+	var captured *ResponseWriter
+	router := New()
+	router.Verbose = false
+	router.LogRequests = true
+	router.Logger = func(w *ResponseWriter, r *http.Request) {
+		captured = w
+	}
+	router.HandleFunc("/upload", func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		time.Sleep(time.Millisecond)
+		w.Write(b)
+	})
+	router.HandleFunc("/abort", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("partial"))
+		panic(http.ErrAbortHandler)
+	})
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/upload", io.NopCloser(strings.NewReader("hello")))
+	router.ServeHTTP(w, req)
+	expect(t, w.Body.String(), "hello")
+	expect(t, captured.BytesRead(), int64(5))
+	expect(t, captured.Size(), 5)
+	expect(t, captured.Duration() >= time.Millisecond, true)
+	expect(t, captured.Duration(), captured.Duration())
+	expect(t, captured.Aborted(), false)
+
+	func() {
+		defer func() {
+			expect(t, recover(), http.ErrAbortHandler)
+		}()
+		req, _ = http.NewRequest("GET", "/abort", nil)
+		router.ServeHTTP(httptest.NewRecorder(), req)
+	}()
+	expect(t, captured.Aborted(), true)
+	expect(t, captured.Size(), 7)
+
+	// client went away
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	req, _ = http.NewRequestWithContext(ctx, "POST", "/upload", strings.NewReader("hello"))
+	router.ServeHTTP(httptest.NewRecorder(), req)
+	expect(t, captured.Aborted(), true)
+}
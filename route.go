@@ -0,0 +1,226 @@
+package violetear
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync/atomic"
+)
+
+// Matcher reports whether the request matches a condition
+type Matcher func(*http.Request) bool
+
+// Route returned by Handle, keeps the node (url part) where the handler was
+// added and the conditions the request must match to be dispatched to it.
+// The route is returned even if it could not be added, in that case the
+// error is reported by Router.GetError, the methods have no effect and the
+// embedded Trie is an empty node not attached to the router.
+type Route struct {
+	*Trie
+	added    bool
+	router   *Router
+	table    *table
+	path     string
+	matchers []Matcher
+
+	// handler without the route middleware
+	handler    http.Handler
+	middleware []Middleware
+
+	// info describes the route, replaced when the route is named
+	info *RouteInfo
+
+	// timeout of the route, hasTimeout is true once its middleware was added
+	timeout    atomic.Int64
+	hasTimeout bool
+}
+
+// RouteInfo describes the route matched by the request, available in the
+// request context using GetRouteInfo or GetRoutePattern. It must not be
+// modified.
+type RouteInfo struct {
+	// Name of the route, empty if Name was not called
+	Name string
+
+	// Pattern used to add the route, example: /root/:uuid/item
+	Pattern string
+
+	// Methods allowed, ALL if no methods were given
+	Methods []string
+
+	// Version of the route, example: v2
+	Version string
+
+	// Host pattern of the sub-router, empty for the main router
+	Host string
+}
+
+// newRouteInfo returns the RouteInfo of a route
+func newRouteInfo(pathParts []string, methods, version, host string) *RouteInfo {
+	info := &RouteInfo{
+		Pattern: "/" + strings.Join(pathParts, "/"),
+		Version: version,
+		Host:    host,
+	}
+	if pathParts[0] == "/" {
+		info.Pattern = "/"
+	}
+	for _, m := range strings.Split(methods, ",") {
+		if m = strings.ToUpper(strings.TrimSpace(m)); m != "" {
+			info.Methods = append(info.Methods, m)
+		}
+	}
+	return info
+}
+
+// routeContext keeps the params and the route matched by the request,
+// available using ParamsKey and RouteKey
+type routeContext struct {
+	context.Context
+	params Params
+	info   *RouteInfo
+}
+
+// Value returns the params for ParamsKey, the route for RouteKey and the
+// value of the parent context otherwise
+func (c *routeContext) Value(k interface{}) interface{} {
+	switch k {
+	case ParamsKey:
+		if c.params != nil {
+			return c.params
+		}
+	case RouteKey:
+		if c.info != nil {
+			return c.info
+		}
+	}
+	return c.Context.Value(k)
+}
+
+// routeInfo returns the route info, nil if the handler was not added by
+// Handle
+func (r *Route) routeInfo() *RouteInfo {
+	if r == nil {
+		return nil
+	}
+	return r.info
+}
+
+// Name add custom name to the route node
+func (r *Route) Name(name string) *Route {
+	if !r.added {
+		return r
+	}
+	r.table.mu.Lock()
+	defer r.table.mu.Unlock()
+	r.Trie.Name(name)
+	// the name belongs to the node, update all the routes sharing it
+	for _, h := range r.Trie.Handler {
+		if h.route != nil && h.route.info != nil {
+			info := *h.route.info
+			info.Name = name
+			h.route.info = &info
+		}
+	}
+	return r
+}
+
+// Match adds custom matchers, all of them must return true for the request
+// to be dispatched to the route handler
+func (r *Route) Match(matchers ...Matcher) *Route {
+	r.table.mu.Lock()
+	defer r.table.mu.Unlock()
+	r.matchers = append(r.matchers, matchers...)
+	return r
+}
+
+// Headers adds a matcher for the request headers using key/value pairs,
+// an empty value only checks that the header is present, example:
+//
+//	router.HandleFunc("/webhook", push, "POST").Headers("X-GitHub-Event", "push")
+func (r *Route) Headers(pairs ...string) *Route {
+	if len(pairs)%2 != 0 {
+		r.router.addError(r.path, fmt.Errorf("headers: number of parameters must be a multiple of 2, got %v", pairs))
+		return r
+	}
+	return r.Match(func(req *http.Request) bool {
+		for i := 0; i < len(pairs); i += 2 {
+			values, ok := req.Header[http.CanonicalHeaderKey(pairs[i])]
+			if !ok || !matchValues(values, pairs[i+1]) {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+// Queries adds a matcher for the URL query values using key/value pairs,
+// an empty value only checks that the key is present, example:
+//
+//	router.HandleFunc("/search", search, "GET").Queries("q", "")
+func (r *Route) Queries(pairs ...string) *Route {
+	if len(pairs)%2 != 0 {
+		r.router.addError(r.path, fmt.Errorf("queries: number of parameters must be a multiple of 2, got %v", pairs))
+		return r
+	}
+	return r.Match(func(req *http.Request) bool {
+		query := req.URL.Query()
+		for i := 0; i < len(pairs); i += 2 {
+			values, ok := query[pairs[i]]
+			if !ok || !matchValues(values, pairs[i+1]) {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+// Schemes adds a matcher for the URL scheme (http, https)
+func (r *Route) Schemes(schemes ...string) *Route {
+	allowed := make([]string, len(schemes))
+	for i, scheme := range schemes {
+		allowed[i] = strings.ToLower(scheme)
+	}
+	return r.Match(func(req *http.Request) bool {
+		scheme := req.URL.Scheme
+		if scheme == "" {
+			scheme = "http"
+			if req.TLS != nil {
+				scheme = "https"
+			}
+		}
+		for _, s := range allowed {
+			if s == scheme {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// match check if the request satisfies all the matchers
+func (r *Route) match(req *http.Request) bool {
+	if r == nil {
+		return true
+	}
+	for _, m := range r.matchers {
+		if !m(req) {
+			return false
+		}
+	}
+	return true
+}
+
+// matchValues check if value is in values, an empty value matches any
+func matchValues(values []string, value string) bool {
+	if value == "" {
+		return true
+	}
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,114 @@
+package violetear
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRouteMatchers(t *testing.T) {
+	router := New()
+	router.Verbose = false
+	body := func(s string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(s))
+		}
+	}
+	router.HandleFunc("/webhook", body("push"), "POST").Headers("X-GitHub-Event", "push")
+	router.HandleFunc("/webhook", body("issues"), "POST").Headers("X-GitHub-Event", "issues")
+	router.HandleFunc("/search", body("query"), "GET").Queries("q", "")
+	router.HandleFunc("/search", body("page"), "GET").Queries("page", "1", "size", "")
+	router.HandleFunc("/secure", body("https"), "GET").Schemes("HTTPS")
+	router.HandleFunc("/custom", body("custom"), "GET").Match(func(r *http.Request) bool {
+		return r.Header.Get("X-Custom") == "yes"
+	})
+	router.HandleFunc("/custom", body("fallback"), "GET")
+	expect(t, router.GetError(), nil)
+
+	tt := []struct {
+		name   string
+		method string
+		path   string
+		header []string
+		tls    bool
+		body   string
+		code   int
+	}{
+		{"push", "POST", "/webhook", []string{"X-GitHub-Event", "push"}, false, "push", 200},
+		{"issues", "POST", "/webhook", []string{"X-GitHub-Event", "issues"}, false, "issues", 200},
+		{"unknown event", "POST", "/webhook", []string{"X-GitHub-Event", "fork"}, false, "404 page not found\n", 404},
+		{"no event", "POST", "/webhook", nil, false, "404 page not found\n", 404},
+		{"method", "GET", "/webhook", nil, false, "Method Not Allowed\n", 405},
+		{"query", "GET", "/search?q=foo", nil, false, "query", 200},
+		{"query page", "GET", "/search?page=1&size=10", nil, false, "page", 200},
+		{"query page 2", "GET", "/search?page=2&size=10", nil, false, "404 page not found\n", 404},
+		{"no query", "GET", "/search", nil, false, "404 page not found\n", 404},
+		{"https", "GET", "/secure", nil, true, "https", 200},
+		{"http", "GET", "/secure", nil, false, "404 page not found\n", 404},
+		{"custom", "GET", "/custom", []string{"X-Custom", "yes"}, false, "custom", 200},
+		{"custom fallback", "GET", "/custom", nil, false, "fallback", 200},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest(tc.method, tc.path, nil)
+			if tc.header != nil {
+				req.Header.Set(tc.header[0], tc.header[1])
+			}
+			if tc.tls {
+				req.TLS = &tls.ConnectionState{}
+			}
+			router.ServeHTTP(w, req)
+			expect(t, w.Code, tc.code)
+			expect(t, w.Body.String(), tc.body)
+		})
+	}
+}
+
+func TestRouteMatchersErrors(t *testing.T) {
+	router := New()
+	router.Verbose = false
+	router.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {}).Headers("X-Odd")
+	expect(t, router.GetError() != nil, true)
+
+	router = New()
+	router.Verbose = false
+	router.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {}).Queries("a", "1", "b")
+	expect(t, router.GetError() != nil, true)
+}
+
+func TestRouteFailedChain(t *testing.T) {
+	router := New()
+	router.Verbose = false
+	route := router.HandleFunc("/:none", func(w http.ResponseWriter, r *http.Request) {})
+	expect(t, router.GetError() != nil, true)
+	expect(t, route.Trie != nil, true)
+	expect(t, len(route.Node), 0)
+	expect(t, len(route.Handler), 0)
+	_, _, _, ok := route.Get("none", "")
+	expect(t, ok, false)
+	route.Name("none").Timeout(time.Second).Use(func(next http.Handler) http.Handler { return next })
+	expect(t, router.GetError().(RouteErrors)[0].Path, "/:none")
+
+	// the routes are not changed
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/none", nil)
+	router.ServeHTTP(w, req)
+	expect(t, w.Code, 404)
+}
+
+func TestRouteName(t *testing.T) {
+	router := New()
+	router.Verbose = false
+	route := router.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		expect(t, GetRouteName(r), "root")
+	}).Name("root").Headers("X-Test", "")
+	expect(t, route.name, "root")
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/", nil)
+	req.Header.Set("X-Test", "1")
+	router.ServeHTTP(w, req)
+	expect(t, w.Code, 200)
+}
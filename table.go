@@ -0,0 +1,91 @@
+package violetear
+
+import "sync"
+
+// table keeps the routes, regular expressions and hosts of a router, it is
+// replaced atomically by Swap so that requests being served always see a
+// complete routing table.
+type table struct {
+	// mu protects the table while adding routes and serving requests, it is
+	// shared with the tables of the host sub-routers since they share the
+	// regular expressions
+	mu *sync.RWMutex
+
+	// dynamicRoutes map of dynamic routes and regular expressions
+	dynamicRoutes dynamicSet
+
+	// Routes to be matched
+	routes *Trie
+
+	// hosts sub-routers matched by the request host
+	hosts []*host
+}
+
+// newTable returns an empty routing table
+func newTable() *table {
+	return &table{
+		mu:            &sync.RWMutex{},
+		dynamicRoutes: dynamicSet{},
+		routes:        &Trie{},
+	}
+}
+
+// table returns the current routing table
+func (r *Router) table() *table {
+	return r.routing.Load().(*table)
+}
+
+// derive returns a router with the same configuration using the routing
+// table t and the error list errs
+func (r *Router) derive(t *table, errs *errorList) *Router {
+	router := &Router{
+		errs:                         errs,
+		Logger:                       r.Logger,
+		LogRequests:                  r.LogRequests,
+		NotFoundHandler:              r.NotFoundHandler,
+		NotAllowedHandler:            r.NotAllowedHandler,
+		NotAcceptableHandler:         r.NotAcceptableHandler,
+		UnsupportedMediaTypeHandler:  r.UnsupportedMediaTypeHandler,
+		RequestEntityTooLargeHandler: r.RequestEntityTooLargeHandler,
+		TimeoutHandler:               r.TimeoutHandler,
+		PanicHandler:                 r.PanicHandler,
+		PanicErrorHandler:            r.PanicErrorHandler,
+		DevMode:                      r.DevMode,
+		RequestID:                    r.RequestID,
+		GenerateRequestID:            r.GenerateRequestID,
+		TrustRequestID:               r.TrustRequestID,
+		Verbose:                      r.Verbose,
+		Slog:                         r.Slog,
+		TraceExporter:                r.TraceExporter,
+	}
+	router.routing.Store(t)
+	return router
+}
+
+// Swap replaces the routing table (routes, regular expressions and hosts)
+// at runtime, it is safe to use while serving requests.
+//
+// build receives an empty router with the same configuration, the new table
+// is built off to the side using it and, only if build returns no error and
+// all the routes were added successfully, it is published atomically.
+// Requests being served keep using the previous table. Example:
+//
+//	err := router.Swap(func(r *violetear.Router) error {
+//	    r.AddRegex(":uuid", `[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}`)
+//	    r.HandleFunc("/:uuid", handleUUID, "GET")
+//	    return nil
+//	})
+//
+// Changes to the configuration of the router passed to build (handlers,
+// LogRequests, etc.) are not published, only its routing table.
+func (r *Router) Swap(build func(*Router) error) error {
+	next := r.derive(newTable(), &errorList{})
+	if err := build(next); err != nil {
+		return err
+	}
+	if err := next.GetError(); err != nil {
+		return err
+	}
+	r.routing.Store(next.table())
+	return nil
+}
@@ -0,0 +1,106 @@
+package violetear
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+func TestSwap(t *testing.T) {
+	router := New()
+	router.Verbose = false
+	router.HandleFunc("/old", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("old"))
+	})
+
+	get := func(path, host string) (int, string) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", path, nil)
+		req.Host = host
+		router.ServeHTTP(w, req)
+		return w.Code, w.Body.String()
+	}
+
+	code, body := get("/old", "")
+	expect(t, code, 200)
+	expect(t, body, "old")
+
+	err := router.Swap(func(r *Router) error {
+		r.AddRegex(":id", `^\d+$`)
+		r.HandleFunc("/new/:id", func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("new " + GetParam("id", r)))
+		}, "GET")
+		r.Host("api.example.com").HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("api"))
+		})
+		return nil
+	})
+	expect(t, err, nil)
+
+	code, _ = get("/old", "")
+	expect(t, code, 404)
+	code, body = get("/new/1", "")
+	expect(t, code, 200)
+	expect(t, body, "new 1")
+	code, body = get("/", "api.example.com")
+	expect(t, code, 200)
+	expect(t, body, "api")
+
+	// build error, keep current table
+	err = router.Swap(func(r *Router) error {
+		r.HandleFunc("/other", func(w http.ResponseWriter, r *http.Request) {})
+		return errors.New("invalid config")
+	})
+	expect(t, err.Error(), "invalid config")
+	code, _ = get("/other", "")
+	expect(t, code, 404)
+
+	// route error, keep current table
+	err = router.Swap(func(r *Router) error {
+		r.HandleFunc("/other/:none", func(w http.ResponseWriter, r *http.Request) {})
+		return nil
+	})
+	expect(t, err != nil, true)
+	code, _ = get("/new/1", "")
+	expect(t, code, 200)
+
+	// invalid regex, keep current table
+	err = router.Swap(func(r *Router) error {
+		return r.AddRegex(":id", "[")
+	})
+	expect(t, err != nil, true)
+	code, _ = get("/new/1", "")
+	expect(t, code, 200)
+}
+
+func TestSwapWhileServing(t *testing.T) {
+	router := New()
+	router.Verbose = false
+	router.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				w := httptest.NewRecorder()
+				req, _ := http.NewRequest("GET", "/", nil)
+				router.ServeHTTP(w, req)
+				if w.Code != 200 {
+					t.Errorf("expected 200, got %d", w.Code)
+				}
+			}
+		}()
+	}
+	for i := 0; i < 50; i++ {
+		err := router.Swap(func(r *Router) error {
+			r.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {})
+			return nil
+		})
+		expect(t, err, nil)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,212 @@
+package violetear
+
+import (
+	"context"
+	"net/http"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+// Timeout sets the time the route has to serve the request, the request
+// context gets the deadline and, if the response was not written when it
+// expires, the TimeoutHandler is called, example:
+//  router.HandleFunc("/report", handleReport, "GET").Timeout(time.Minute)
+// The handler keeps running in its own goroutine until it returns, once the
+// timeout expires its writes return http.ErrHandlerTimeout. Unlike
+// http.TimeoutHandler the response is not buffered, streaming and Flush
+// keep working but a response being streamed can't be replaced. Calling
+// Timeout again replaces the timeout, 0 disables it.
+func (r *Route) Timeout(d time.Duration) *Route {
+	if !r.added {
+		return r
+	}
+	r.timeout.Store(int64(d))
+	r.table.mu.Lock()
+	installed := r.hasTimeout
+	r.hasTimeout = true
+	r.table.mu.Unlock()
+	if installed {
+		return r
+	}
+	return r.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			r.router.serveTimeout(w, req, next, time.Duration(r.timeout.Load()))
+		})
+	})
+}
+
+// ServiceUnavailable default handler for 503, used when the timeout of the
+// route expires
+func (r *Router) ServiceUnavailable() http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w,
+			http.StatusText(http.StatusServiceUnavailable),
+			http.StatusServiceUnavailable,
+		)
+	})
+}
+
+// serveTimeout serves the request with a deadline of d
+func (r *Router) serveTimeout(w http.ResponseWriter, req *http.Request, next http.Handler, d time.Duration) {
+	if d <= 0 {
+		next.ServeHTTP(w, req)
+		return
+	}
+	ctx, cancel := context.WithTimeout(req.Context(), d)
+	defer cancel()
+	req = req.WithContext(ctx)
+
+	tw := &timeoutWriter{w: w, h: w.Header().Clone(), ctx: ctx}
+	done := make(chan struct{})
+	panicked := make(chan interface{}, 1)
+	go func() {
+		defer func() {
+			if p := recover(); p != nil {
+				// keep the stack of the handler, the panic is raised again
+				// in the goroutine serving the request
+				if _, ok := p.(*PanicError); !ok && p != http.ErrAbortHandler {
+					p = &PanicError{Value: p, Stack: debug.Stack()}
+				}
+				panicked <- p
+				return
+			}
+			close(done)
+		}()
+		next.ServeHTTP(tw, req)
+	}()
+
+	select {
+	case p := <-panicked:
+		tw.mu.Lock()
+		tw.timedOut = true
+		tw.mu.Unlock()
+		// the router recovers it
+		panic(p)
+	case <-done:
+		tw.mu.Lock()
+		defer tw.mu.Unlock()
+		if tw.wroteHeader {
+			return
+		}
+		// the handler tried to write after the deadline
+		if tw.timedOut {
+			r.timeout(w, req)
+			return
+		}
+		tw.copyHeader()
+	case <-ctx.Done():
+		tw.mu.Lock()
+		defer tw.mu.Unlock()
+		tw.timedOut = true
+		// the client went away, nothing to write
+		if ctx.Err() == context.DeadlineExceeded && !tw.wroteHeader {
+			r.timeout(w, req)
+		}
+	}
+}
+
+// timeout serves the TimeoutHandler
+func (r *Router) timeout(w http.ResponseWriter, req *http.Request) {
+	if r.TimeoutHandler != nil {
+		r.TimeoutHandler.ServeHTTP(w, req)
+		return
+	}
+	r.ServiceUnavailable().ServeHTTP(w, req)
+}
+
+// timeoutWriter guards the writes of a handler that may run after its
+// timeout expired, the handler gets its own header until it writes it
+type timeoutWriter struct {
+	w           http.ResponseWriter
+	h           http.Header
+	ctx         context.Context
+	mu          sync.Mutex
+	wroteHeader bool
+	timedOut    bool
+}
+
+// Header returns the header of the handler
+func (tw *timeoutWriter) Header() http.Header {
+	return tw.h
+}
+
+// Write writes the data, http.ErrHandlerTimeout after the timeout
+func (tw *timeoutWriter) Write(data []byte) (int, error) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.expired() {
+		return 0, http.ErrHandlerTimeout
+	}
+	if !tw.wroteHeader {
+		tw.writeHeader(http.StatusOK)
+	}
+	return tw.w.Write(data)
+}
+
+// WriteHeader writes the header unless the timeout expired
+func (tw *timeoutWriter) WriteHeader(statusCode int) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.expired() || tw.wroteHeader {
+		return
+	}
+	// informational headers can be written before the final one
+	if statusCode >= 100 && statusCode < 200 && statusCode != http.StatusSwitchingProtocols {
+		tw.copyHeader()
+		tw.w.WriteHeader(statusCode)
+		return
+	}
+	tw.writeHeader(statusCode)
+}
+
+// Flush flushes the data written unless the timeout expired, implements
+// http.Flusher
+func (tw *timeoutWriter) Flush() {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.expired() {
+		return
+	}
+	if !tw.wroteHeader {
+		tw.writeHeader(http.StatusOK)
+	}
+	if f, ok := tw.w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap returns the wrapped http.ResponseWriter, used by
+// http.ResponseController
+func (tw *timeoutWriter) Unwrap() http.ResponseWriter {
+	return tw.w
+}
+
+// expired reports whether the timeout expired, the writes are discarded
+func (tw *timeoutWriter) expired() bool {
+	if !tw.timedOut && tw.ctx.Err() == context.DeadlineExceeded {
+		tw.timedOut = true
+	}
+	return tw.timedOut
+}
+
+// writeHeader copies the header of the handler and writes it
+func (tw *timeoutWriter) writeHeader(statusCode int) {
+	tw.copyHeader()
+	tw.wroteHeader = true
+	tw.w.WriteHeader(statusCode)
+}
+
+// copyHeader replaces the header of the wrapped writer with the header of
+// the handler
+func (tw *timeoutWriter) copyHeader() {
+	dst := tw.w.Header()
+	for k := range dst {
+		if _, ok := tw.h[k]; !ok {
+			delete(dst, k)
+		}
+	}
+	for k, v := range tw.h {
+		dst[k] = v
+	}
+}
@@ -0,0 +1,130 @@
+package violetear
+
+import (
+	"bufio"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRouteTimeout(t *testing.T) {
+	router := New()
+	router.Verbose = false
+	router.RequestID = "Request-ID"
+	late := make(chan error, 1)
+	router.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+		w.Header().Set("X-Late", "yes")
+		_, err := w.Write([]byte("late"))
+		late <- err
+	}, "GET").Timeout(10 * time.Millisecond)
+	router.HandleFunc("/fast", func(w http.ResponseWriter, r *http.Request) {
+		_, ok := r.Context().Deadline()
+		expect(t, ok, true)
+		w.Header().Set("X-Fast", "yes")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("fast"))
+	}, "GET").Timeout(time.Second)
+	router.HandleFunc("/header", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Header", "yes")
+	}, "GET").Timeout(time.Second)
+	router.HandleFunc("/disabled", func(w http.ResponseWriter, r *http.Request) {
+		_, ok := r.Context().Deadline()
+		expect(t, ok, false)
+	}, "GET").Timeout(time.Second).Timeout(0)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/slow", nil)
+	req.Header.Set("Request-ID", "123")
+	router.ServeHTTP(w, req)
+	expect(t, w.Code, http.StatusServiceUnavailable)
+	expect(t, w.Body.String(), "Service Unavailable\n")
+	expect(t, w.Header().Get("Request-ID"), "123")
+	expect(t, <-late, http.ErrHandlerTimeout)
+	expect(t, w.Header().Get("X-Late"), "")
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/fast", nil)
+	router.ServeHTTP(w, req)
+	expect(t, w.Code, http.StatusCreated)
+	expect(t, w.Body.String(), "fast")
+	expect(t, w.Header().Get("X-Fast"), "yes")
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/header", nil)
+	router.ServeHTTP(w, req)
+	expect(t, w.Code, http.StatusOK)
+	expect(t, w.Header().Get("X-Header"), "yes")
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/disabled", nil)
+	router.ServeHTTP(w, req)
+	expect(t, w.Code, http.StatusOK)
+
+	router.TimeoutHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusGatewayTimeout)
+	})
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/slow", nil)
+	router.ServeHTTP(w, req)
+	expect(t, w.Code, http.StatusGatewayTimeout)
+	<-late
+}
+
+func TestRouteTimeoutPanic(t *testing.T) {
+	router := New()
+	router.Verbose = false
+	router.Slog = slog.New(slog.NewTextHandler(io.Discard, nil))
+	var pe *PanicError
+	router.PanicErrorHandler = func(w http.ResponseWriter, r *http.Request, err *PanicError) {
+		pe = err
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+	router.HandleFunc("/panic", panicHandler).Timeout(time.Second)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/panic", nil)
+	router.ServeHTTP(w, req)
+	expect(t, w.Code, http.StatusInternalServerError)
+	expect(t, pe.Value, "timeout panic")
+	// the stack is the one of the handler goroutine
+	expect(t, strings.Contains(string(pe.Stack), pkgPath+".panicHandler"), true)
+}
+
+func panicHandler(w http.ResponseWriter, r *http.Request) {
+	panic("timeout panic")
+}
+
+func TestRouteTimeoutStreaming(t *testing.T) {
+	router := New()
+	router.Verbose = false
+	release := make(chan struct{})
+	written := make(chan error, 1)
+	router.HandleFunc("/stream", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("first\n"))
+		w.(http.Flusher).Flush()
+		<-release
+		<-r.Context().Done()
+		_, err := w.Write([]byte("second\n"))
+		written <- err
+	}, "GET").Timeout(50 * time.Millisecond)
+
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	res, err := http.Get(ts.URL + "/stream")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	expect(t, res.StatusCode, http.StatusOK)
+	line, err := bufio.NewReader(res.Body).ReadString('\n')
+	expect(t, err, nil)
+	expect(t, line, "first\n")
+	close(release)
+	expect(t, <-written, http.ErrHandlerTimeout)
+}
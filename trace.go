@@ -0,0 +1,285 @@
+package violetear
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// W3C Trace Context headers
+const (
+	TraceparentHeader = "traceparent"
+	TracestateHeader  = "tracestate"
+)
+
+// FlagSampled trace flag set when the trace is sampled
+const FlagSampled byte = 0x01
+
+// TraceID identifies a trace
+type TraceID [16]byte
+
+// SpanID identifies a span
+type SpanID [8]byte
+
+// IsValid reports whether the trace ID is not all zeros
+func (t TraceID) IsValid() bool {
+	return t != TraceID{}
+}
+
+// String returns the trace ID in lowercase hex
+func (t TraceID) String() string {
+	return hex.EncodeToString(t[:])
+}
+
+// MarshalText encodes the trace ID in lowercase hex
+func (t TraceID) MarshalText() ([]byte, error) {
+	return []byte(t.String()), nil
+}
+
+// IsValid reports whether the span ID is not all zeros
+func (s SpanID) IsValid() bool {
+	return s != SpanID{}
+}
+
+// String returns the span ID in lowercase hex
+func (s SpanID) String() string {
+	return hex.EncodeToString(s[:])
+}
+
+// MarshalText encodes the span ID in lowercase hex
+func (s SpanID) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// SpanContext identifies the span of a request within a trace
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+	Flags   byte
+
+	// State value of the tracestate header
+	State string
+
+	// Remote true when the span context was received from the caller
+	Remote bool
+}
+
+// IsValid reports whether the trace and span IDs are valid
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID.IsValid() && sc.SpanID.IsValid()
+}
+
+// Sampled reports whether the trace is sampled
+func (sc SpanContext) Sampled() bool {
+	return sc.Flags&FlagSampled != 0
+}
+
+// Traceparent returns the value for the traceparent header
+func (sc SpanContext) Traceparent() string {
+	return "00-" + sc.TraceID.String() + "-" + sc.SpanID.String() + "-" + hex.EncodeToString([]byte{sc.Flags})
+}
+
+// Inject sets the traceparent and tracestate headers, used to propagate the
+// trace to outgoing requests, example:
+//  violetear.GetSpanContext(r).Inject(outgoing.Header)
+func (sc SpanContext) Inject(h http.Header) {
+	if !sc.IsValid() {
+		return
+	}
+	h.Set(TraceparentHeader, sc.Traceparent())
+	if sc.State != "" {
+		h.Set(TracestateHeader, sc.State)
+	} else {
+		h.Del(TracestateHeader)
+	}
+}
+
+// ParseTraceparent parses the value of the traceparent header
+func ParseTraceparent(s string) (SpanContext, error) {
+	var sc SpanContext
+	s = strings.TrimSpace(s)
+	// version-traceid-parentid-flags
+	if len(s) < 55 || s[2] != '-' || s[35] != '-' || s[52] != '-' {
+		return sc, errors.New("traceparent: invalid format")
+	}
+	version, err := decodeHex(s[:2])
+	if err != nil || version[0] == 0xff {
+		return sc, errors.New("traceparent: invalid version")
+	}
+	// future versions may append fields
+	if (version[0] == 0 && len(s) != 55) || (len(s) > 55 && s[55] != '-') {
+		return sc, errors.New("traceparent: invalid format")
+	}
+	traceID, err := decodeHex(s[3:35])
+	if err != nil {
+		return sc, errors.New("traceparent: invalid trace-id")
+	}
+	spanID, err := decodeHex(s[36:52])
+	if err != nil {
+		return sc, errors.New("traceparent: invalid parent-id")
+	}
+	flags, err := decodeHex(s[53:55])
+	if err != nil {
+		return sc, errors.New("traceparent: invalid trace-flags")
+	}
+	copy(sc.TraceID[:], traceID)
+	copy(sc.SpanID[:], spanID)
+	sc.Flags = flags[0]
+	sc.Remote = true
+	if !sc.IsValid() {
+		return SpanContext{}, errors.New("traceparent: all zeros trace-id or parent-id")
+	}
+	return sc, nil
+}
+
+// decodeHex decodes lowercase hex
+func decodeHex(s string) ([]byte, error) {
+	if strings.ToLower(s) != s {
+		return nil, errors.New("uppercase hex")
+	}
+	return hex.DecodeString(s)
+}
+
+// GetSpanContext returns the span context of the request, invalid if the
+// router has no TraceExporter
+func GetSpanContext(r *http.Request) SpanContext {
+	if span, ok := r.Context().Value(SpanKey).(*Span); ok {
+		return span.SpanContext
+	}
+	return SpanContext{}
+}
+
+// Span the server side of a request within a trace
+type Span struct {
+	// Name pattern of the matched route, the method when no route was matched
+	Name string `json:"name"`
+
+	SpanContext SpanContext `json:"-"`
+
+	// Parent span ID received in the traceparent header
+	Parent SpanID `json:"parent_id"`
+
+	Start    time.Time     `json:"start"`
+	Duration time.Duration `json:"duration"`
+
+	// Attributes using the OpenTelemetry HTTP semantic conventions
+	Attributes map[string]interface{} `json:"attributes"`
+}
+
+// MarshalJSON encodes the span including the trace and span IDs
+func (s *Span) MarshalJSON() ([]byte, error) {
+	type span Span
+	return json.Marshal(struct {
+		TraceID TraceID `json:"trace_id"`
+		SpanID  SpanID  `json:"span_id"`
+		*span
+	}{s.SpanContext.TraceID, s.SpanContext.SpanID, (*span)(s)})
+}
+
+// SpanExporter receives the spans ended by the router
+type SpanExporter interface {
+	ExportSpan(*Span)
+}
+
+// InMemoryExporter keeps the spans in memory, useful for tests
+type InMemoryExporter struct {
+	mu    sync.Mutex
+	spans []*Span
+}
+
+// ExportSpan appends the span
+func (e *InMemoryExporter) ExportSpan(s *Span) {
+	e.mu.Lock()
+	e.spans = append(e.spans, s)
+	e.mu.Unlock()
+}
+
+// Spans returns the exported spans
+func (e *InMemoryExporter) Spans() []*Span {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]*Span(nil), e.spans...)
+}
+
+// Reset removes the exported spans
+func (e *InMemoryExporter) Reset() {
+	e.mu.Lock()
+	e.spans = nil
+	e.mu.Unlock()
+}
+
+// JSONExporter writes one JSON object per span
+type JSONExporter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewJSONExporter returns a JSONExporter writing to w, os.Stdout if nil
+func NewJSONExporter(w io.Writer) *JSONExporter {
+	if w == nil {
+		w = os.Stdout
+	}
+	return &JSONExporter{w: w}
+}
+
+// ExportSpan writes the span
+func (e *JSONExporter) ExportSpan(s *Span) {
+	b, err := json.Marshal(s)
+	if err != nil {
+		return
+	}
+	e.mu.Lock()
+	e.w.Write(append(b, '\n'))
+	e.mu.Unlock()
+}
+
+// startSpan starts the span of the request continuing the trace received
+// in the traceparent header, returns the request with the span in the
+// context and the traceparent header of the new span
+func (r *Router) startSpan(w *ResponseWriter, req *http.Request) (*Span, *http.Request) {
+	span := &Span{
+		Start: w.start,
+		Attributes: map[string]interface{}{
+			"http.request.method": req.Method,
+			"url.path":            req.URL.Path,
+		},
+	}
+	if parent, err := ParseTraceparent(req.Header.Get(TraceparentHeader)); err == nil {
+		span.SpanContext.TraceID = parent.TraceID
+		span.SpanContext.Flags = parent.Flags
+		span.SpanContext.State = strings.Join(req.Header.Values(TracestateHeader), ",")
+		span.Parent = parent.SpanID
+	} else {
+		rand.Read(span.SpanContext.TraceID[:])
+		span.SpanContext.Flags = FlagSampled
+	}
+	rand.Read(span.SpanContext.SpanID[:])
+
+	req = req.WithContext(context.WithValue(req.Context(), SpanKey, span))
+	// the next handlers see the span of the request as the parent
+	req.Header = req.Header.Clone()
+	span.SpanContext.Inject(req.Header)
+	return span, req
+}
+
+// endSpan sets the name, status and duration of the span and exports it
+func (r *Router) endSpan(span *Span, w *ResponseWriter) {
+	span.Duration = w.Duration()
+	span.Name = span.Attributes["http.request.method"].(string)
+	if info := w.Route(); info != nil {
+		span.Name = info.Pattern
+		span.Attributes["http.route"] = info.Pattern
+	}
+	span.Attributes["http.response.status_code"] = w.Status()
+	if span.SpanContext.Sampled() {
+		r.TraceExporter.ExportSpan(span)
+	}
+}
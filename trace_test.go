@@ -0,0 +1,142 @@
+package violetear
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParseTraceparent(t *testing.T) {
+	tt := []struct {
+		name   string
+		value  string
+		err    bool
+		trace  string
+		span   string
+		sample bool
+	}{
+		{"valid", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", false, "4bf92f3577b34da6a3ce929d0e0e4736", "00f067aa0ba902b7", true},
+		{"not sampled", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00", false, "4bf92f3577b34da6a3ce929d0e0e4736", "00f067aa0ba902b7", false},
+		{"future version", "01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", false, "4bf92f3577b34da6a3ce929d0e0e4736", "00f067aa0ba902b7", true},
+		{"version 00 extra", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", true, "", "", false},
+		{"version ff", "ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", true, "", "", false},
+		{"uppercase", "00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01", true, "", "", false},
+		{"zero trace", "00-00000000000000000000000000000000-00f067aa0ba902b7-01", true, "", "", false},
+		{"zero span", "00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01", true, "", "", false},
+		{"short", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7", true, "", "", false},
+		{"empty", "", true, "", "", false},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			sc, err := ParseTraceparent(tc.value)
+			expect(t, err != nil, tc.err)
+			if tc.err {
+				return
+			}
+			expect(t, sc.TraceID.String(), tc.trace)
+			expect(t, sc.SpanID.String(), tc.span)
+			expect(t, sc.Sampled(), tc.sample)
+			expect(t, sc.Remote, true)
+		})
+	}
+}
+
+func TestTrace(t *testing.T) {
+	exporter := &InMemoryExporter{}
+	router := New()
+	router.Verbose = false
+	router.TraceExporter = exporter
+	router.AddRegex(":id", `^\d+$`)
+
+	var sc SpanContext
+	router.HandleFunc("/item/:id", func(w http.ResponseWriter, r *http.Request) {
+		sc = GetSpanContext(r)
+		expect(t, r.Header.Get(TraceparentHeader), sc.Traceparent())
+		w.WriteHeader(http.StatusAccepted)
+	})
+	router.HandleFunc("/panic", func(w http.ResponseWriter, r *http.Request) {
+		panic("panic")
+	})
+
+	// continue the trace
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/item/1", nil)
+	req.Header.Set(TraceparentHeader, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	req.Header.Set(TracestateHeader, "congo=t61rcWkgMzE")
+	router.ServeHTTP(w, req)
+	expect(t, w.Code, http.StatusAccepted)
+	expect(t, sc.TraceID.String(), "4bf92f3577b34da6a3ce929d0e0e4736")
+	expect(t, sc.SpanID.String() != "00f067aa0ba902b7", true)
+	expect(t, sc.State, "congo=t61rcWkgMzE")
+	expect(t, req.Header.Get(TraceparentHeader), "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+
+	spans := exporter.Spans()
+	expect(t, len(spans), 1)
+	expect(t, spans[0].Name, "/item/:id")
+	expect(t, spans[0].SpanContext, sc)
+	expect(t, spans[0].Parent.String(), "00f067aa0ba902b7")
+	expect(t, spans[0].Attributes["http.response.status_code"], http.StatusAccepted)
+	expect(t, spans[0].Attributes["http.route"], "/item/:id")
+	expect(t, spans[0].Duration > 0, true)
+
+	// new trace
+	exporter.Reset()
+	req, _ = http.NewRequest("POST", "/none", nil)
+	router.ServeHTTP(httptest.NewRecorder(), req)
+	spans = exporter.Spans()
+	expect(t, len(spans), 1)
+	expect(t, spans[0].Name, "POST")
+	expect(t, spans[0].SpanContext.IsValid(), true)
+	expect(t, spans[0].Parent.IsValid(), false)
+	expect(t, spans[0].Attributes["http.response.status_code"], http.StatusNotFound)
+
+	// panic
+	exporter.Reset()
+	req, _ = http.NewRequest("GET", "/panic", nil)
+	router.ServeHTTP(httptest.NewRecorder(), req)
+	spans = exporter.Spans()
+	expect(t, len(spans), 1)
+	expect(t, spans[0].Name, "/panic")
+	expect(t, spans[0].Attributes["http.response.status_code"], http.StatusInternalServerError)
+
+	// not sampled
+	exporter.Reset()
+	req, _ = http.NewRequest("GET", "/item/1", nil)
+	req.Header.Set(TraceparentHeader, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00")
+	router.ServeHTTP(httptest.NewRecorder(), req)
+	expect(t, len(exporter.Spans()), 0)
+}
+
+func TestSpanContextInject(t *testing.T) {
+	sc, _ := ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	sc.State = "a=1"
+	h := http.Header{}
+	sc.Inject(h)
+	expect(t, h.Get(TraceparentHeader), "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	expect(t, h.Get(TracestateHeader), "a=1")
+
+	h = http.Header{}
+	SpanContext{}.Inject(h)
+	expect(t, len(h), 0)
+}
+
+func TestJSONExporter(t *testing.T) {
+	var out bytes.Buffer
+	router := New()
+	router.Verbose = false
+	router.TraceExporter = NewJSONExporter(&out)
+	router.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {})
+	req, _ := http.NewRequest("GET", "/", nil)
+	req.Header.Set(TraceparentHeader, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	var span map[string]interface{}
+	expect(t, json.Unmarshal(out.Bytes(), &span), nil)
+	expect(t, span["name"], "/")
+	expect(t, span["trace_id"], "4bf92f3577b34da6a3ce929d0e0e4736")
+	expect(t, span["parent_id"], "00f067aa0ba902b7")
+	expect(t, len(span["span_id"].(string)), 16)
+	expect(t, span["attributes"].(map[string]interface{})["http.response.status_code"], float64(200))
+}
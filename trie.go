@@ -10,6 +10,15 @@ import (
 type MethodHandler struct {
 	Method  string
 	Handler http.Handler
+
+	// ContentType media types accepted in the request body, empty accepts any
+	ContentType []string
+
+	// Accept media types the handler can produce, empty produces any
+	Accept []string
+
+	// route the handler belongs to
+	route *Route
 }
 
 // Trie data structure
@@ -35,6 +44,12 @@ func (t *Trie) contains(path, version string) (*Trie, bool) {
 
 // Set adds a node (url part) to the Trie
 func (t *Trie) Set(path []string, handler http.Handler, method, version string) (*Trie, error) {
+	return t.set(path, MethodHandler{Handler: handler}, method, version)
+}
+
+// set adds a node (url part) to the Trie using mh as the template for every
+// method
+func (t *Trie) set(path []string, mh MethodHandler, method, version string) (*Trie, error) {
 	if len(path) == 0 {
 		return nil, errors.New("path cannot be empty")
 	}
@@ -67,7 +82,8 @@ func (t *Trie) Set(path []string, handler http.Handler, method, version string)
 			return c == ','
 		})
 		for _, v := range methods {
-			node.Handler = append(node.Handler, MethodHandler{strings.ToUpper(strings.TrimSpace(v)), handler})
+			mh.Method = strings.ToUpper(strings.TrimSpace(v))
+			node.Handler = append(node.Handler, mh)
 		}
 		return node, nil
 	}
@@ -76,7 +92,7 @@ func (t *Trie) Set(path []string, handler http.Handler, method, version string)
 		return nil, errors.New("catch-all \"*\" must always be the final path element")
 	}
 
-	return node.Set(newpath, handler, method, version)
+	return node.set(newpath, mh, method, version)
 }
 
 // Get returns a node
@@ -49,14 +49,23 @@ package violetear
 import (
 	"context"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
 // ParamsKey used for the context
 const (
 	ParamsKey     key = 0
+	matchedKey    key = 1
+	RouteKey      key = 2
+	writerKey     key = 3
+	RequestIDKey  key = 4
+	SpanKey       key = 5
+	PanicKey      key = 6
 	versionHeader     = "application/vnd."
 )
 
@@ -64,13 +73,11 @@ const (
 // other packages.
 type key int
 
-// Router struct
+// Router struct, routes, regular expressions and hosts can be added from
+// multiple goroutines, also while serving requests.
 type Router struct {
-	// dynamicRoutes map of dynamic routes and regular expressions
-	dynamicRoutes dynamicSet
-
-	// Routes to be matched
-	routes *Trie
+	// routing current *table with the routes, regular expressions and hosts
+	routing atomic.Value
 
 	// Logger
 	Logger func(*ResponseWriter, *http.Request)
@@ -85,44 +92,114 @@ type Router struct {
 	// NotAllowedHandler configurable http.Handler which is called when method not allowed.
 	NotAllowedHandler http.Handler
 
-	// PanicHandler function to handle panics.
+	// NotAcceptableHandler configurable http.Handler which is called when
+	// none of the media types in the Accept header can be produced.
+	NotAcceptableHandler http.Handler
+
+	// UnsupportedMediaTypeHandler configurable http.Handler which is called
+	// when the request Content-Type is not accepted.
+	UnsupportedMediaTypeHandler http.Handler
+
+	// RequestEntityTooLargeHandler configurable http.Handler which is called
+	// when the request body exceeds the limit of the route.
+	RequestEntityTooLargeHandler http.Handler
+
+	// TimeoutHandler configurable http.Handler which is called when the
+	// timeout of the route expires before the response is written. If it is
+	// not set, 503 Service Unavailable is returned.
+	TimeoutHandler http.Handler
+
+	// PanicHandler function to handle panics, the recovered value is
+	// available using GetPanic.
 	PanicHandler http.HandlerFunc
 
+	// PanicErrorHandler function to handle panics receiving the recovered
+	// value and the stack, used instead of the PanicHandler.
+	PanicErrorHandler func(http.ResponseWriter, *http.Request, *PanicError)
+
+	// DevMode the default panic handler responds with a page (HTML or JSON)
+	// showing the panic and the stack, must not be used in production.
+	DevMode bool
+
 	// RequestID name of the header to use or create.
 	RequestID string
 
-	// Verbose
+	// GenerateRequestID creates the request ID when the request doesn't
+	// have one or it is not trusted, example: violetear.UUIDv4. RequestID
+	// must be set.
+	GenerateRequestID func() string
+
+	// TrustRequestID reports whether the request ID received can be used,
+	// all of them are trusted if nil.
+	TrustRequestID func(id string, r *http.Request) bool
+
+	// Verbose log the routes being added
 	Verbose bool
 
-	// Error resulted from building a route.
-	err error
+	// TraceExporter enables the W3C Trace Context propagation, a span named
+	// after the matched route pattern is exported for every sampled request.
+	TraceExporter SpanExporter
+
+	// Slog logger for the router messages, routes added (Info level when
+	// Verbose) and recovered panics (Error level), slog.Default() if nil.
+	Slog *slog.Logger
+
+	// middleware current *chain built by Use
+	middleware atomic.Value
+
+	// pre current *chain built by Pre
+	pre atomic.Value
+
+	// mu serializes the calls to Use and Pre, protects stats
+	mu sync.Mutex
+
+	// stats added with AddStats
+	stats map[string]RouteStats
+
+	// Errors resulted from building the routes, shared with the host
+	// sub-routers.
+	errs *errorList
+
+	// host pattern handled by the router, empty if it is not a sub-router
+	host string
 }
 
 // New returns a new initialized router.
 func New() *Router {
-	return &Router{
-		dynamicRoutes: dynamicSet{},
-		routes:        &Trie{},
-		Logger:        logger,
-		Verbose:       true,
+	r := &Router{
+		Logger:  logger,
+		Verbose: true,
+		errs:    &errorList{},
 	}
+	r.routing.Store(newTable())
+	return r
 }
 
 // Handle registers the handler for the given pattern (path, http.Handler, methods).
-func (r *Router) Handle(path string, handler http.Handler, httpMethods ...string) *Trie {
+// Optionally after the methods the media types accepted or produced by the
+// handler can be declared, example:
+//  router.Handle("/upload", h, "POST", "Content-Type: application/json, multipart/form-data")
+//  router.Handle("/report", h, "GET", "Accept: text/csv")
+func (r *Router) Handle(path string, handler http.Handler, httpMethods ...string) *Route {
 	var version string
 	if i := strings.Index(path, "#"); i != -1 {
 		version = path[i+1:]
 		path = path[:i]
 	}
 	pathParts := r.splitPath(path)
+	t := r.table()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	// the route is returned even on failure so it is safe to chain
+	route := &Route{Trie: &Trie{}, router: r, table: t, path: path, handler: handler}
 
 	// search for dynamic routes
 	for _, p := range pathParts {
 		if strings.HasPrefix(p, ":") {
-			if _, ok := r.dynamicRoutes[p]; !ok {
-				r.err = fmt.Errorf("[%s] not found, need to add it using AddRegex(%q, `your regex`", p, p)
-				return nil
+			if _, ok := t.dynamicRoutes[p]; !ok {
+				r.addError(path, fmt.Errorf("[%s] not found, need to add it using AddRegex(%q, `your regex`", p, p))
+				return route
 			}
 		}
 	}
@@ -133,26 +210,62 @@ func (r *Router) Handle(path string, handler http.Handler, httpMethods ...string
 		methods = httpMethods[0]
 	}
 
+	// media types accepted (Content-Type) or produced (Accept)
+	mh := MethodHandler{Handler: handler, route: route}
+	if len(httpMethods) > 1 {
+		for _, constraint := range httpMethods[1:] {
+			if strings.TrimSpace(constraint) == "" {
+				continue
+			}
+			header, types, err := parseMediaTypes(constraint)
+			if err != nil {
+				r.addError(path, err)
+				return route
+			}
+			if header == "accept" {
+				mh.Accept = append(mh.Accept, types...)
+			} else {
+				mh.ContentType = append(mh.ContentType, types...)
+			}
+		}
+	}
+
 	if r.Verbose {
-		log.Printf("Adding path: %s [%s] %s", path, methods, version)
+		r.log().Info("Adding path", "path", path, "methods", methods, "version", version)
 	}
 
-	trie, err := r.routes.Set(pathParts, handler, methods, version)
+	route.info = newRouteInfo(pathParts, methods, version, r.host)
+
+	trie, err := t.routes.set(pathParts, mh, methods, version)
 	if err != nil {
-		r.err = err
-		return nil
+		r.addError(path, err)
+		return route
+	}
+	route.Trie, route.added = trie, true
+	// the node may have been named by a previous route
+	route.info.Name = trie.name
+	return route
+}
+
+// log returns the logger for the router messages
+func (r *Router) log() *slog.Logger {
+	if r.Slog != nil {
+		return r.Slog
 	}
-	return trie
+	return slog.Default()
 }
 
 // HandleFunc add a route to the router (path, http.HandlerFunc, methods)
-func (r *Router) HandleFunc(path string, handler http.HandlerFunc, httpMethods ...string) *Trie {
+func (r *Router) HandleFunc(path string, handler http.HandlerFunc, httpMethods ...string) *Route {
 	return r.Handle(path, handler, httpMethods...)
 }
 
 // AddRegex adds a ":named" regular expression to the dynamicRoutes
 func (r *Router) AddRegex(name, regex string) error {
-	return r.dynamicRoutes.Set(name, regex)
+	t := r.table()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.dynamicRoutes.Set(name, regex)
 }
 
 // MethodNotAllowed default handler for 405
@@ -165,24 +278,126 @@ func (r *Router) MethodNotAllowed() http.HandlerFunc {
 	})
 }
 
-// checkMethod check if request method is allowed or not
-func (r *Router) checkMethod(node *Trie, method string) http.Handler {
+// NotAcceptable default handler for 406
+func (r *Router) NotAcceptable() http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w,
+			http.StatusText(http.StatusNotAcceptable),
+			http.StatusNotAcceptable,
+		)
+	})
+}
+
+// UnsupportedMediaType default handler for 415
+func (r *Router) UnsupportedMediaType() http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w,
+			http.StatusText(http.StatusUnsupportedMediaType),
+			http.StatusUnsupportedMediaType,
+		)
+	})
+}
+
+// RequestEntityTooLarge default handler for 413
+func (r *Router) RequestEntityTooLarge() http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w,
+			http.StatusText(http.StatusRequestEntityTooLarge),
+			http.StatusRequestEntityTooLarge,
+		)
+	})
+}
+
+// checkMethod check if request method, route conditions and media types are
+// allowed or not
+func (r *Router) checkMethod(node *Trie, req *http.Request) (http.Handler, *RouteInfo) {
+	// when no handler matches, the most specific failure is reported
+	const (
+		methodNotAllowed = iota
+		conditionsNotMatched
+		unsupportedMediaType
+		notAcceptable
+	)
+	var (
+		handler http.Handler
+		info    *RouteInfo
+		quality float64
+		generic bool
+		ranges  []acceptRange
+		parsed  bool
+		failure = methodNotAllowed
+	)
 	for _, h := range node.Handler {
-		if h.Method == "ALL" {
-			return h.Handler
+		if h.Method != "ALL" && h.Method != req.Method {
+			continue
+		}
+		// the request doesn't match the route conditions, try the next one
+		if !h.route.match(req) {
+			if failure < conditionsNotMatched {
+				failure = conditionsNotMatched
+			}
+			continue
+		}
+		// no media types declared, first match wins unless a handler
+		// declaring them matches
+		if len(h.ContentType) == 0 && len(h.Accept) == 0 {
+			if handler == nil {
+				handler, info, quality, generic = h.Handler, h.route.routeInfo(), 0, true
+			}
+			continue
+		}
+		if !matchContentType(h.ContentType, req.Header.Get("Content-Type")) {
+			if failure < unsupportedMediaType {
+				failure = unsupportedMediaType
+			}
+			continue
+		}
+		if !parsed {
+			ranges, parsed = parseAccept(req.Header.Get("Accept")), true
+		}
+		// the handler producing the media type with the highest quality wins
+		q := acceptQuality(h.Accept, ranges)
+		if q < 0 {
+			failure = notAcceptable
+			continue
 		}
-		if h.Method == method {
-			return h.Handler
+		if handler == nil || generic || q > quality {
+			handler, info, quality, generic = h.Handler, h.route.routeInfo(), q, false
 		}
 	}
+	if handler != nil {
+		return handler, info
+	}
+	switch failure {
+	case conditionsNotMatched:
+		return r.notFound(), nil
+	case unsupportedMediaType:
+		if r.UnsupportedMediaTypeHandler != nil {
+			return r.UnsupportedMediaTypeHandler, nil
+		}
+		return r.UnsupportedMediaType(), nil
+	case notAcceptable:
+		if r.NotAcceptableHandler != nil {
+			return r.NotAcceptableHandler, nil
+		}
+		return r.NotAcceptable(), nil
+	}
 	if r.NotAllowedHandler != nil {
-		return r.NotAllowedHandler
+		return r.NotAllowedHandler, nil
+	}
+	return r.MethodNotAllowed(), nil
+}
+
+// notFound returns the handler for 404
+func (r *Router) notFound() http.Handler {
+	if r.NotFoundHandler != nil {
+		return r.NotFoundHandler
 	}
-	return r.MethodNotAllowed()
+	return http.NotFoundHandler()
 }
 
-// dispatch request
-func (r *Router) dispatch(node *Trie, key, path, method, version string, leaf bool, params Params) (http.Handler, Params) {
+// dispatch request, returns the handler, the params and the matched route
+func (r *Router) dispatch(t *table, node *Trie, key, path, version string, leaf bool, req *http.Request, params Params) (http.Handler, Params, *RouteInfo) {
 	catchall := false
 	if node.name != "" {
 		if params == nil {
@@ -191,11 +406,12 @@ func (r *Router) dispatch(node *Trie, key, path, method, version string, leaf bo
 		params.Add("rname", node.name)
 	}
 	if len(node.Handler) > 0 && leaf {
-		return r.checkMethod(node, method), params
+		h, info := r.checkMethod(node, req)
+		return h, params, info
 	} else if node.HasRegex {
 		for _, n := range node.Node {
 			if strings.HasPrefix(n.path, ":") {
-				rx := r.dynamicRoutes[n.path]
+				rx := t.dynamicRoutes[n.path]
 				if rx.MatchString(key) {
 					// add param to context
 					if params == nil {
@@ -203,7 +419,7 @@ func (r *Router) dispatch(node *Trie, key, path, method, version string, leaf bo
 					}
 					params.Add(n.path, key)
 					node, key, path, leaf := node.Get(n.path+path, version)
-					return r.dispatch(node, key, path, method, version, leaf, params)
+					return r.dispatch(t, node, key, path, version, leaf, req, params)
 				}
 			}
 		}
@@ -224,27 +440,44 @@ func (r *Router) dispatch(node *Trie, key, path, method, version string, leaf bo
 				if n.name != "" {
 					params.Add("rname", n.name)
 				}
-				return r.checkMethod(n, method), params
+				h, info := r.checkMethod(n, req)
+				return h, params, info
 			}
 		}
 	}
 	// NotFound
-	if r.NotFoundHandler != nil {
-		return r.NotFoundHandler, params
-	}
-	return http.NotFoundHandler(), params
+	return r.notFound(), params, nil
 }
 
 // ServeHTTP dispatches the handler registered in the matched path
 func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	var (
+		hw   http.ResponseWriter
+		ww   *ResponseWriter
+		span *Span
+	)
+
 	// panic handler
 	defer func() {
 		if err := recover(); err != nil {
-			log.Printf("panic: %s", err)
-			if r.PanicHandler != nil {
-				r.PanicHandler(w, req)
-			} else {
-				http.Error(w, http.StatusText(500), http.StatusInternalServerError)
+			// the panic happened before wrapping the writer
+			if ww == nil && r.wrapWriter() {
+				hw, ww = WrapResponseWriter(w, "")
+			}
+			if hw == nil {
+				hw = w
+			}
+			// let net/http abort the response
+			if err == http.ErrAbortHandler {
+				if ww != nil {
+					ww.aborted = true
+					r.endRequest(ww, req, span)
+				}
+				panic(err)
+			}
+			r.recoverPanic(hw, ww, req, err)
+			if ww != nil {
+				r.endRequest(ww, req, span)
 			}
 		}
 	}()
@@ -252,17 +485,67 @@ func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	// Request-ID
 	var rid string
 	if r.RequestID != "" {
-		if rid = req.Header.Get(r.RequestID); rid != "" {
+		rid, req = r.requestID(req)
+		if rid != "" {
 			w.Header().Set(r.RequestID, rid)
 		}
 	}
 
-	// wrap ResponseWriter
-	var ww *ResponseWriter
+	// the writer is only wrapped when its state is used
+	if !r.wrapWriter() {
+		r.preRoute(w, req)
+		return
+	}
+
+	// wrap ResponseWriter, hw keeps the optional interfaces of w
+	hw, ww = WrapResponseWriter(w, rid)
+	if r.LogRequests || r.TraceExporter != nil {
+		// used to keep the matched route for the logger and the span
+		req = req.WithContext(context.WithValue(req.Context(), writerKey, ww))
+	}
+
+	// trace context
+	if r.TraceExporter != nil {
+		span, req = r.startSpan(ww, req)
+	}
+
+	// count the bytes read from the request body for the logger
+	if r.LogRequests && req.Body != nil && req.Body != http.NoBody {
+		r2 := *req
+		r2.Body = &countBody{ReadCloser: req.Body, w: ww}
+		req = &r2
+	}
+
+	// dispatch request
+	r.preRoute(hw, req)
+	// the client went away
+	if req.Context().Err() != nil {
+		ww.aborted = true
+	}
+	r.endRequest(ww, req, span)
+}
+
+// wrapWriter reports whether the ResponseWriter must be wrapped, used by the
+// logger, the span and the panic handlers to know the state of the response
+func (r *Router) wrapWriter() bool {
+	return r.LogRequests || r.TraceExporter != nil || r.DevMode ||
+		r.PanicHandler != nil || r.PanicErrorHandler != nil
+}
+
+// endRequest sets the end time of the request, ends the span and logs the
+// request
+func (r *Router) endRequest(ww *ResponseWriter, req *http.Request, span *Span) {
+	ww.end = time.Now()
+	if span != nil {
+		r.endSpan(span, ww)
+	}
 	if r.LogRequests {
-		ww = NewResponseWriter(w, rid)
+		r.Logger(ww, req)
 	}
+}
 
+// routeRequest finds the handler for the request and serves it
+func (r *Router) routeRequest(w http.ResponseWriter, req *http.Request) {
 	// set version based on the value of "Accept: application/vnd.*"
 	version := req.Header.Get("Accept")
 	if i := strings.LastIndex(version, versionHeader); i != -1 {
@@ -271,27 +554,43 @@ func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 		version = ""
 	}
 
-	// query the path from left to right
-	node, key, path, leaf := r.routes.Get(req.URL.Path, version)
+	// find the handler
+	h, p, info, router := r.match(req, version)
 
-	// dispatch the request
-	h, p := r.dispatch(node, key, path, req.Method, version, leaf, nil)
-
-	// dispatch request
-	if r.LogRequests {
-		if p == nil {
-			h.ServeHTTP(ww, req)
-		} else {
-			h.ServeHTTP(ww, req.WithContext(context.WithValue(req.Context(), ParamsKey, p)))
-		}
-		r.Logger(ww, req)
-	} else {
-		if p == nil {
-			h.ServeHTTP(w, req)
-		} else {
-			h.ServeHTTP(w, req.WithContext(context.WithValue(req.Context(), ParamsKey, p)))
+	// a single context keeps the params and the route
+	if p != nil || info != nil {
+		req = req.WithContext(&routeContext{Context: req.Context(), params: p, info: info})
+	}
+	if info != nil {
+		if ww, ok := req.Context().Value(writerKey).(*ResponseWriter); ok {
+			ww.route = info
 		}
 	}
+	r.serve(w, req, h, router)
+}
+
+// match returns the handler for the request, the params found in the host
+// and path, the matched route and the router where the handler was found
+func (r *Router) match(req *http.Request, version string) (http.Handler, Params, *RouteInfo, *Router) {
+	router, t := r, r.table()
+
+	// find the router handling the host
+	t.mu.RLock()
+	sub, params := t.matchHost(req)
+	t.mu.RUnlock()
+	if sub != nil {
+		router, t = sub, sub.table()
+	}
+
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	// query the path from left to right
+	node, key, path, leaf := t.routes.Get(req.URL.Path, version)
+
+	// dispatch the request
+	h, params, info := router.dispatch(t, node, key, path, version, leaf, req, params)
+	return h, params, info, router
 }
 
 // splitPath returns an slice of the path
@@ -306,7 +605,17 @@ func (r *Router) splitPath(p string) []string {
 	return pathParts
 }
 
-// GetError returns an error resulted from building a route, if any.
+// addError keeps the error resulted from building a route, path is the path
+// of the route or the host pattern
+func (r *Router) addError(path string, err error) {
+	r.errs.add(newRouteError(path, err))
+}
+
+// GetError returns all the errors resulted from building the routes as
+// RouteErrors, if any.
 func (r *Router) GetError() error {
-	return r.err
+	if errs := r.errs.get(); len(errs) > 0 {
+		return errs
+	}
+	return nil
 }
@@ -7,10 +7,12 @@ import (
 	"fmt"
 	"io/ioutil"
 	"log"
+	"log/slog"
 	"net/http"
 	"net/http/httptest"
 	"reflect"
 	"runtime"
+	"strings"
 	"testing"
 
 	"github.com/nbari/violetear/middleware"
@@ -279,6 +281,27 @@ func TestPanicHandler(t *testing.T) {
 	expect(t, string(b), "ne ne ne\n")
 }
 
+func TestSlog(t *testing.T) {
+	var out bytes.Buffer
+	router := New()
+	router.Slog = slog.New(slog.NewTextHandler(&out, &slog.HandlerOptions{ReplaceAttr: noTime}))
+	router.HandleFunc("/panic", func(w http.ResponseWriter, r *http.Request) {
+		panic("si si si")
+	}, "GET")
+	router.Host("api.example.com").HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {})
+	router.Verbose = false
+	router.HandleFunc("/quiet", func(w http.ResponseWriter, r *http.Request) {})
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/panic", nil)
+	router.ServeHTTP(w, req)
+	expect(t, w.Code, http.StatusInternalServerError)
+
+	expect(t, strings.HasPrefix(out.String(), `level=INFO msg="Adding path" path=/panic methods=GET version=""
+level=INFO msg="Adding path" path=/ methods=ALL version=""
+level=ERROR msg=panic error="si si si" method=GET url=/panic stack="goroutine `), true)
+}
+
 func TestHandleFunc(t *testing.T) {
 	tt := []struct {
 		name string
@@ -769,3 +792,100 @@ func TestReturnedTrieChaining(t *testing.T) {
 		})
 	}
 }
+
+func TestContentNegotiation(t *testing.T) {
+	router := New()
+	router.Verbose = false
+	body := func(s string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(s))
+		}
+	}
+	router.HandleFunc("/upload", body("json"), "POST", "Content-Type: application/json")
+	router.HandleFunc("/upload", body("multipart"), "POST", "Content-Type: multipart/form-data")
+	router.HandleFunc("/upload", body("protobuf"), "PUT", "Content-Type: application/x-protobuf")
+	router.HandleFunc("/report", body("json"), "GET", "Accept: application/json")
+	router.HandleFunc("/report", body("csv"), "GET", "Accept: text/csv")
+	router.HandleFunc("/any", body("any"), "GET")
+	router.HandleFunc("/any", body("csv"), "GET", "Accept: text/csv")
+	router.HandleFunc("/user", body("generic"), "POST")
+	router.HandleFunc("/user", body("json"), "POST", "Content-Type: application/json")
+	expect(t, router.GetError(), nil)
+
+	tt := []struct {
+		name        string
+		path        string
+		method      string
+		contentType string
+		accept      string
+		body        string
+		code        int
+	}{
+		{"json", "/upload", "POST", "application/json", "", "json", 200},
+		{"json charset", "/upload", "POST", "application/json; charset=utf-8", "", "json", 200},
+		{"multipart", "/upload", "POST", "multipart/form-data; boundary=x", "", "multipart", 200},
+		{"protobuf", "/upload", "PUT", "application/x-protobuf", "", "protobuf", 200},
+		{"415", "/upload", "POST", "text/plain", "", "Unsupported Media Type", 415},
+		{"415 no content-type", "/upload", "POST", "", "", "Unsupported Media Type", 415},
+		{"405", "/upload", "GET", "application/json", "", "Method Not Allowed", 405},
+		{"report no accept", "/report", "GET", "", "", "json", 200},
+		{"report json", "/report", "GET", "", "application/json", "json", 200},
+		{"report csv", "/report", "GET", "", "text/csv", "csv", 200},
+		{"report q", "/report", "GET", "", "application/json;q=0.5, text/csv", "csv", 200},
+		{"report wildcard", "/report", "GET", "", "text/*", "csv", 200},
+		{"406", "/report", "GET", "", "application/xml", "Not Acceptable", 406},
+		{"any", "/any", "GET", "", "application/xml", "any", 200},
+		{"any csv", "/any", "GET", "", "text/csv", "csv", 200},
+		{"user json", "/user", "POST", "application/json", "", "json", 200},
+		{"user generic", "/user", "POST", "text/plain", "", "generic", 200},
+		{"user no content-type", "/user", "POST", "", "", "generic", 200},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest(tc.method, tc.path, nil)
+			if tc.contentType != "" {
+				req.Header.Set("Content-Type", tc.contentType)
+			}
+			if tc.accept != "" {
+				req.Header.Set("Accept", tc.accept)
+			}
+			router.ServeHTTP(w, req)
+			expect(t, w.Code, tc.code)
+			expect(t, string(bytes.TrimSpace(w.Body.Bytes())), tc.body)
+		})
+	}
+}
+
+func TestContentNegotiationHandlers(t *testing.T) {
+	router := New()
+	router.Verbose = false
+	router.NotAcceptableHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotAcceptable)
+		w.Write([]byte("custom 406"))
+	})
+	router.UnsupportedMediaTypeHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnsupportedMediaType)
+		w.Write([]byte("custom 415"))
+	})
+	router.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {}, "POST", "Content-Type: application/json", "Accept: application/json")
+	expect(t, router.GetError(), nil)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/", nil)
+	req.Header.Set("Content-Type", "text/plain")
+	router.ServeHTTP(w, req)
+	expect(t, w.Code, 415)
+	expect(t, w.Body.String(), "custom 415")
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/", nil)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "text/csv")
+	router.ServeHTTP(w, req)
+	expect(t, w.Code, 406)
+	expect(t, w.Body.String(), "custom 406")
+
+	router.HandleFunc("/bad", func(w http.ResponseWriter, r *http.Request) {}, "POST", "Content: application/json")
+	expect(t, router.GetError() != nil, true)
+}